@@ -1,20 +1,52 @@
 package fade
 
 import (
-	"fmt"
+	"context"
 	"image"
 	"sort"
 )
 
 const (
 	branchingFactor = 3
+
+	// Below this many cells an expansion is too quick to be worth splitting
+	// across goroutines
+	minParallelCells = 1024
 )
 
-// AStar uses the A* search algorithm to find the optimal fading path. Currently
-// it is preventatively slow
-func AStar(in, out *image.Gray, c Config) []*image.Gray {
-	searcher := newAStarSearch(in, out, c.Scale)
-	return searcher.run(1)
+func init() {
+	Register(NewTransitioner("astar",
+		"Searches for a short fading path with A* (slow)", AStarStream))
+}
+
+// AStar uses the A* search algorithm to find a short fading path. Currently
+// it is preventatively slow. c.AStar chooses between standard, weighted and
+// greedy search.
+func AStar(ctx context.Context, in, out *image.Gray, c Config) ([]*image.Gray, error) {
+	return collect(ctx, AStarStream, in, out, c)
+}
+
+// AStarStream is the streaming form of AStar. Frames are produced once the
+// search has found a path. If ctx is done first, the path to the closest node
+// found so far is written and ctx.Err() returned. With c.AStar.Pyramid the
+// path is spread over at most c.NumIterations frames, and a cancelled search
+// writes the path of the finest level finished so far.
+func AStarStream(ctx context.Context, in, out *image.Gray, c Config, sink FrameSink) error {
+	if c.AStar.Pyramid && c.Scale > 1 {
+		return aStarPyramidStream(ctx, in, out, c, sink)
+	}
+
+	progress := c.progress()
+	progress.Start("A* search", 0)
+	defer progress.Done()
+
+	in, out = Normalize(in, out, c.Fit)
+	searcher := newAStarSearch(in, out, c)
+	finalNode, err := searcher.run(ctx, 1)
+	if pathErr := searcher.writePath(finalNode, sink); pathErr != nil {
+		return pathErr
+	}
+	return err
 }
 
 type searchStats struct {
@@ -25,90 +57,160 @@ type searchStats struct {
 	nextFValue        int
 }
 
-func (s searchStats) print() {
-	fmt.Printf("\r%+v\n", s)
+func (s searchStats) log(logger Logger) {
+	logger.Logf("%+v", s)
 }
 
 type aStarSearch struct {
 	originalInput *image.Gray
-	input         *image.Gray
-	output        *image.Gray
-	scale         int
+	grid          searchGrid
+	start         []uint8 // starting value of each cell
+	goal          []uint8 // desired value of each cell
+	state         []int   // scratch space for the cells of the node being expanded
 	stats         searchStats
 	open          priorityQueue
 	closed        nodeSet
+	root          *node
+	best          *node    // closest to the output so far
+	other         *nodeSet // nodes seen by a search in the opposite direction
+	met           *node    // node of the other search where the two met
+	workers       int
+	progress      Progress
+	logger        Logger
 }
 
-func newAStarSearch(input, output *image.Gray, scale int) aStarSearch {
-	open := newPriorityQueue()
-	firstNode := newNode(0, 0, 0, nil)
-	firstNode.h = initialH(input, output, scale)
+func newAStarSearch(input, output *image.Gray, c Config) aStarSearch {
+	grid := newSearchGrid(input.Bounds(), c.Scale)
+	start, goal := grid.cells(input), grid.cells(output)
+
+	open := newPriorityQueue(c.AStar)
+	firstNode := newRootNode(start, initialH(start, goal), mismatches(start, goal))
 	open.add(&firstNode)
-	fmt.Printf("in constructor open len %d\n", open.len())
 	return aStarSearch{
 		input,
-		copyGray(input),
-		output,
-		scale,
+		grid,
+		start,
+		goal,
+		make([]int, grid.len()),
 		searchStats{0, 0, 0, 0, 0},
 		open,
 		newNodeSet(),
+		&firstNode,
+		&firstNode,
+		nil,
+		nil,
+		c.Workers,
+		c.progress(),
+		c.logger(),
+	}
+}
+
+// mismatches counts the cells which are not at the goal
+func mismatches(start, goal []uint8) int {
+	count := 0
+	for i := range start {
+		if start[i] != goal[i] {
+			count++
+		}
 	}
+	return count
 }
 
-func initialH(in, out *image.Gray, scale int) int {
+func initialH(start, goal []uint8) int {
 	h := 0
-	forEachPixelScaled(in.Bounds(), func(x, y int) {
-		h += abs(int(in.GrayAt(x, y).Y - out.GrayAt(x, y).Y))
-	}, scale)
+	for i := range start {
+		h += abs(int(goal[i]) - int(start[i]))
+	}
 	return h
 }
 
-func (a *aStarSearch) run(numTimes int) []*image.Gray {
+// run searches until a path is found. If ctx is done first it returns the
+// best node so far with ctx.Err().
+func (a *aStarSearch) run(ctx context.Context, numTimes int) (*node, error) {
+	if a.best.h == 0 {
+		// Already there
+		return a.best, nil
+	}
+
 	// main loop
 	counter := 0
 	for {
-		fmt.Printf("open length: %d\n", a.open.len())
-		if a.open.len() > 0 {
-			q := a.open.getAndRemoveLowest()
-			if finalNode := a.makeChildrenAddToOpenList(q); finalNode != nil {
-				return a.makePath(finalNode)
-			}
-			a.closed.add(q)
+		if err := ctx.Err(); err != nil {
+			return a.best, err
+		}
+
+		if finalNode := a.step(); finalNode != nil {
+			return finalNode, nil
 		}
 		counter++
 
 		if counter == numTimes {
-			a.open.cull()
-
-			a.stats.numProcessed += numTimes
-			a.stats.currentOpenLength = a.open.len()
-			next := a.open.peek()
-			if next != nil {
-				a.stats.nextGValue = next.g
-				a.stats.nextHValue = next.h
-				a.stats.nextFValue = next.f()
-			}
-
-			a.stats.print()
+			a.report(numTimes)
+			a.progress.Update(a.stats.numProcessed)
 			counter = 0
 		}
 	}
 }
 
-func (a *aStarSearch) makePath(n *node) []*image.Gray {
-	currentNode := n
-	result := []*image.Gray{a.originalInput}
-	lastImage := a.originalInput
+// step expands the lowest node on the open list. It returns the node which
+// completes a path, if one was found.
+func (a *aStarSearch) step() *node {
+	if a.open.len() == 0 {
+		return nil
+	}
+
+	q := a.open.getAndRemoveLowest()
+	if q.h < a.best.h {
+		a.best = q
+	}
+	if finalNode := a.makeChildrenAddToOpenList(q); finalNode != nil {
+		return finalNode
+	}
+	a.closed.add(q)
+	return nil
+}
+
+// report culls the open list and logs stats after numTimes steps
+func (a *aStarSearch) report(numTimes int) {
+	a.open.cull()
+
+	a.stats.numProcessed += numTimes
+	a.stats.currentOpenLength = a.open.len()
+	next := a.open.peek()
+	if next != nil {
+		a.stats.nextGValue = next.g
+		a.stats.nextHValue = next.h
+		a.stats.nextFValue = next.f()
+	}
+
+	a.stats.log(a.logger)
+}
+
+// writePath replays the diffs from the start of the search to n, writing an
+// image for each step
+func (a *aStarSearch) writePath(n *node, sink FrameSink) error {
+	return a.writeJoinedPath(n, a.root, sink)
+}
+
+// pathSteps lists the pixel each step from the start of the search to n sets
+func (a *aStarSearch) pathSteps(n *node) []pathStep {
+	var path []*node
+	for currentNode := n; currentNode.parent != nil; currentNode = currentNode.parent {
+		path = append(path, currentNode)
+	}
 
-	for currentNode != nil {
-		lastImage = currentNode.makeImage(lastImage)
-		result = append(result, lastImage)
-		currentNode = currentNode.parent
+	for i, v := range a.start {
+		a.state[i] = int(v)
 	}
 
-	reverseSlice(result)
-	return result
+	steps := make([]pathStep, 0, len(path))
+	for i := len(path) - 1; i >= 0; i-- {
+		cell := int(path[i].cell)
+		a.state[cell] += int(path[i].diff)
+		x, y := a.grid.point(cell)
+		steps = append(steps, pathStep{x, y, uint8(a.state[cell])})
+	}
+	return steps
 }
 
 // Returns all valid children of a given image instance node
@@ -118,26 +220,75 @@ func (a *aStarSearch) makeChildrenAddToOpenList(n *node) *node {
 		return finalNode
 	}
 
-	log("found %d possible children", len(possibleChildren))
+	a.logger.Logf("found %d possible children", len(possibleChildren))
 
 	for _, child := range possibleChildren {
-		if !a.shouldSkip(child) {
-			a.open.add(child)
+		if a.shouldSkip(child) {
+			continue
 		}
+		if a.other != nil {
+			if met := a.other.get(child.hash); met != nil {
+				a.met = met
+				return child
+			}
+		}
+		a.open.add(child)
 	}
 	return nil
 }
 
 func (a *aStarSearch) makePossibleChildren(n *node) ([]*node, *node) {
+	for i, v := range a.start {
+		a.state[i] = int(v)
+	}
+	n.loadState(a.state)
+
+	// Each row of cells is expanded separately, then the rows are joined in
+	// order so the result does not depend on scheduling
+	rows := make([][]*node, a.grid.h)
+	goals := make([]*node, a.grid.h)
+
+	workers := a.workers
+	if a.grid.len() < minParallelCells {
+		workers = 1
+	}
+	forEachBand(image.Rect(0, 0, a.grid.w, a.grid.h), workers, func(band image.Rectangle) {
+		for row := band.Min.Y; row < band.Max.Y; row++ {
+			rows[row], goals[row] = a.expandRow(n, row)
+			if goals[row] != nil {
+				return
+			}
+		}
+	})
+
 	possibleChildren := []*node{}
+	for row := range rows {
+		if goals[row] != nil {
+			return []*node{}, goals[row]
+		}
+		possibleChildren = append(possibleChildren, rows[row]...)
+	}
+
+	return possibleChildren, nil
+}
+
+// expandRow makes the children of n changing a cell in the given row of the
+// grid. It stops early if a child reaches the goal.
+func (a *aStarSearch) expandRow(n *node, row int) ([]*node, *node) {
+	rowChildren := []*node{}
 
-	forEachPixelScaled(a.input.Bounds(), func(x, y int) {
-		diffs := a.getPossibleDiffs(n, x, y)
+	for cell := row * a.grid.w; cell < (row+1)*a.grid.w; cell++ {
+		diffs := a.getPossibleDiffs(cell)
 		pixelChildren := []*node{}
 		for _, diff := range diffs {
-			newNode := newNode(x, y, diff.diff, n)
+			newNode := newNode(cell, a.state[cell], diff.diff, n)
 			newNode.h = n.h + diff.deltaH
+			newNode.remaining = n.remaining + int32(diff.deltaRemaining)
 			pixelChildren = append(pixelChildren, &newNode)
+
+			if newNode.remaining == 0 {
+				return nil, &newNode
+			}
 		}
 
 		// For speed, just choose the top branches
@@ -148,41 +299,39 @@ func (a *aStarSearch) makePossibleChildren(n *node) ([]*node, *node) {
 			pixelChildren = pixelChildren[:branchingFactor]
 		}
 
-		possibleChildren = append(possibleChildren, pixelChildren...)
-	}, a.scale)
-
-	for _, child := range possibleChildren {
-		if child.diff != 0 && child.equalsImage(a.input, a.output, a.scale) {
-			return []*node{}, child
-		}
+		rowChildren = append(rowChildren, pixelChildren...)
 	}
 
-	return possibleChildren, nil
+	return rowChildren, nil
 }
 
-// Returns true if the node is present with a smaller f value in either
-// the closed or open list.
+// Returns true if the node makes no change or reaches a state which has
+// already been seen. Seen states are not reopened when a cheaper way to them
+// turns up, which is one reason the path may not be the shortest.
 func (a *aStarSearch) shouldSkip(n *node) bool {
 	return n.diff == 0 || a.open.doesAllSeenHaveThisNode(n)
 }
 
 type diff struct {
-	diff   int
-	deltaH int
+	diff           int
+	deltaH         int
+	deltaRemaining int // change in the number of cells not yet at the goal
 }
 
-func (a *aStarSearch) getPossibleDiffs(parent *node, x, y int) []diff {
-	currentPixel := parent.getPixelValue(x, y, a.input)
-	desiredPixel := int(a.output.GrayAt(x, y).Y)
+// getPossibleDiffs lists the changes to a cell of the current state: copying
+// any neighbor or fading by one
+func (a *aStarSearch) getPossibleDiffs(cell int) []diff {
+	currentPixel := a.state[cell]
+	desiredPixel := int(a.goal[cell])
 	currentDiff := desiredPixel - currentPixel
 
-	posX := getPossibleValues(x, 0, a.input.Bounds().Dx())
-	posY := getPossibleValues(y, 0, a.input.Bounds().Dy())
-
 	diffs := []diff{}
 
 	// add the diff if needed
 	addIfNeeded := func(d int) {
+		if d == 0 {
+			return
+		}
 		// Check to make sure we don't have this diff
 		for _, thisDiff := range diffs {
 			if thisDiff.diff == d {
@@ -192,23 +341,20 @@ func (a *aStarSearch) getPossibleDiffs(parent *node, x, y int) []diff {
 		}
 		newDiff := desiredPixel - (currentPixel + d)
 		deltaH := abs(newDiff) - abs(currentDiff)
-		diffs = append(diffs, diff{diff: d, deltaH: deltaH})
-	}
 
-	for _, i := range posX {
-		for _, j := range posY {
-			var option int
-			if i == x && j == y {
-				// No need to recalculate
-				option = currentPixel
-			} else {
-				option = parent.getPixelValue(i, j, a.input)
-			}
-
-			addIfNeeded(option - currentPixel)
+		deltaRemaining := 0
+		if currentDiff == 0 {
+			deltaRemaining = 1
+		} else if newDiff == 0 {
+			deltaRemaining = -1
 		}
+		diffs = append(diffs, diff{d, deltaH, deltaRemaining})
 	}
 
+	a.grid.neighbors(cell, func(neighbor int) {
+		addIfNeeded(a.state[neighbor] - currentPixel)
+	})
+
 	for _, i := range []int{-1, 1} {
 		if currentPixel+i >= 0 && currentPixel+i <= 255 {
 			addIfNeeded(i)
@@ -217,18 +363,3 @@ func (a *aStarSearch) getPossibleDiffs(parent *node, x, y int) []diff {
 
 	return diffs
 }
-
-// Returns a list of all possible neighbors in one dimension clamped to the bounds
-func getPossibleValues(n, min, max int) []int {
-	options := make([]int, 3)
-	if n > min {
-		options = append(options, n-1)
-	}
-
-	options = append(options, n)
-
-	if n < max {
-		options = append(options, n+1)
-	}
-	return options
-}
@@ -0,0 +1,109 @@
+package fade
+
+// AStarConfig tunes the A* based transitioners
+type AStarConfig struct {
+	// Strategy chooses how the open list is ordered
+	Strategy SearchStrategy
+	// Weight multiplies the heuristic for SearchWeighted. Values below 1 are
+	// treated as 1, which is the same as SearchStandard.
+	Weight float64
+	// TieBreak orders nodes of equal priority
+	TieBreak TieBreak
+	// BeamWidth bounds how many nodes the open list holds: once it grows to
+	// twice the width, the nodes with the worst priority are evicted down to
+	// the width. Zero picks a width from the distance left to the goal, and a
+	// negative width keeps every node.
+	BeamWidth int
+	// Pyramid solves coarse to fine when Config.Scale is above one: first on
+	// images downsampled by Scale, then refining that path at successively
+	// finer levels up to full resolution. Without it a Scale above one only
+	// searches every Scale-th pixel.
+	Pyramid bool
+}
+
+// SearchStrategy chooses how nodes on the open list are prioritized
+type SearchStrategy int
+
+const (
+	// SearchStandard orders by f = g + h, as in textbook A*. The path is not
+	// guaranteed to be the shortest: h sums the differences left, but copying
+	// a neighbor can close a large difference in one step, and only the best
+	// few changes to each cell are explored.
+	SearchStandard SearchStrategy = iota
+	// SearchWeighted orders by g + Weight*h, favoring progress over path
+	// length to search faster
+	SearchWeighted
+	// SearchGreedy orders by h alone (greedy best-first)
+	SearchGreedy
+)
+
+var searchStrategyNames = map[SearchStrategy]string{
+	SearchStandard: "standard",
+	SearchWeighted: "weighted",
+	SearchGreedy:   "greedy",
+}
+
+func (s SearchStrategy) String() string {
+	if name, ok := searchStrategyNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseSearchStrategy returns the SearchStrategy with the given name
+func ParseSearchStrategy(name string) (SearchStrategy, bool) {
+	for s, n := range searchStrategyNames {
+		if n == name {
+			return s, true
+		}
+	}
+	return SearchStandard, false
+}
+
+// TieBreak orders nodes on the open list which have the same priority
+type TieBreak int
+
+const (
+	// TieBreakLowH prefers the node closer to the goal
+	TieBreakLowH TieBreak = iota
+	// TieBreakFIFO prefers the node added first
+	TieBreakFIFO
+	// TieBreakLIFO prefers the node added last
+	TieBreakLIFO
+)
+
+var tieBreakNames = map[TieBreak]string{
+	TieBreakLowH: "low-h",
+	TieBreakFIFO: "fifo",
+	TieBreakLIFO: "lifo",
+}
+
+func (t TieBreak) String() string {
+	if name, ok := tieBreakNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseTieBreak returns the TieBreak with the given name
+func ParseTieBreak(name string) (TieBreak, bool) {
+	for t, n := range tieBreakNames {
+		if n == name {
+			return t, true
+		}
+	}
+	return TieBreakLowH, false
+}
+
+// priority is the key the open list is ordered by, lowest first
+func (c AStarConfig) priority(n *node) float64 {
+	switch c.Strategy {
+	case SearchGreedy:
+		return float64(n.h)
+	case SearchWeighted:
+		if c.Weight > 1 {
+			return float64(n.g) + c.Weight*float64(n.h)
+		}
+	}
+	return float64(n.f())
+}
@@ -1,43 +1,114 @@
 package fade
 
 import (
-	"fmt"
 	"image"
 	"image/color"
 	"math"
-	"reflect"
+	"sort"
 )
 
-type node struct {
-	x      int            // Position x
-	y      int            // Position y
-	diff   int            // Change to the pixel at this location
-	parent *node          // Parent of this node
-	g      int            // cost to get here
-	h      int            // estimated cost to completion
-	diffs  map[string]int // map of keys containing x,y positions to the diffs at that location
-}
-
-func newNode(x, y, diff int, parent *node) node {
-	g, h := 0, 0
-	diffs := map[string]int{}
-	if parent != nil {
-		h = parent.h - abs(diff)
-		g = parent.g + 1
-		for k, v := range parent.diffs {
-			diffs[k] = v
+// searchGrid maps the pixels a search works on to dense cell indices. With a
+// scale above one only every scale-th pixel in each direction is a cell, and
+// the search never touches the pixels in between.
+type searchGrid struct {
+	rect  image.Rectangle // pixel bounds being searched
+	scale int
+	w, h  int // size in cells
+}
+
+func newSearchGrid(rect image.Rectangle, scale int) searchGrid {
+	if scale < 1 {
+		scale = 1
+	}
+	return searchGrid{
+		rect,
+		scale,
+		(rect.Dx() + scale - 1) / scale,
+		(rect.Dy() + scale - 1) / scale,
+	}
+}
+
+func (g searchGrid) len() int {
+	return g.w * g.h
+}
+
+// point returns the pixel coordinates of a cell
+func (g searchGrid) point(cell int) (x, y int) {
+	return g.rect.Min.X + (cell%g.w)*g.scale, g.rect.Min.Y + (cell/g.w)*g.scale
+}
+
+// cells reads the value of every cell of img
+func (g searchGrid) cells(img *image.Gray) []uint8 {
+	values := make([]uint8, g.len())
+	for i := range values {
+		values[i] = img.GrayAt(g.point(i)).Y
+	}
+	return values
+}
+
+// neighbors calls fn with each cell in the 3x3 block around cell, including
+// cell itself
+func (g searchGrid) neighbors(cell int, fn func(neighbor int)) {
+	cx, cy := cell%g.w, cell/g.w
+	for y := maxInt(cy-1, 0); y <= minInt(cy+1, g.h-1); y++ {
+		for x := maxInt(cx-1, 0); x <= minInt(cx+1, g.w-1); x++ {
+			fn(y*g.w + x)
 		}
 	}
+}
+
+// A node is one step of a search: a single change to a single cell. The full
+// state is only stored implicitly as the sum of the diffs along the parent
+// chain, and is identified by a hash which is updated incrementally.
+type node struct {
+	cell      int32   // Index of the changed cell
+	diff      int16   // Change to the cell at this location
+	parent    *node   // Parent of this node
+	g         int     // cost to get here
+	h         int     // estimated cost to completion
+	remaining int32   // number of cells not yet at the goal
+	hash      uint64  // hash of the complete state after this change
+	priority  float64 // open list key, set when added
+	seq       uint64  // order added to the open list
+}
+
+// newNode makes a child of parent changing cell from value by diff
+func newNode(cell, value, diff int, parent *node) node {
+	return node{
+		int32(cell),
+		int16(diff),
+		parent,
+		parent.g + 1,
+		parent.h,
+		parent.remaining,
+		parent.hash - cellHash(cell, value) + cellHash(cell, value+diff),
+		0,
+		0,
+	}
+}
 
-	key := makeNodeDiffKey(x, y)
-	newVal := diff
-	if val, ok := diffs[key]; ok {
-		newVal += val
+// newRootNode is the starting state of a search
+func newRootNode(values []uint8, h, remaining int) node {
+	var hash uint64
+	for cell, value := range values {
+		hash += cellHash(cell, int(value))
 	}
+	return node{-1, 0, nil, 0, h, int32(remaining), hash, 0, 0}
+}
 
-	diffs[key] = newVal
+// cellHash mixes a cell and its value. The state hash is the sum over all
+// cells, so one change only costs a subtraction and an addition, like Zobrist
+// hashing without needing a table per cell and value.
+func cellHash(cell, value int) uint64 {
+	return splitmix64(uint64(cell)<<8 | uint64(value&0xff))
+}
 
-	return node{x, y, diff, parent, g, h, diffs}
+// splitmix64 scrambles z so nearby inputs give unrelated outputs
+func splitmix64(z uint64) uint64 {
+	z += 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
 }
 
 // Total cost
@@ -45,81 +116,95 @@ func (n *node) f() int {
 	return n.g + n.h
 }
 
-func (n *node) equals(other *node) bool {
-	return len(n.diffs) == len(other.diffs) && reflect.DeepEqual(n.diffs, other.diffs)
+// loadState writes the cell values at this node into state, which must start
+// as a copy of the search's starting values
+func (n *node) loadState(state []int) {
+	for current := n; current.parent != nil; current = current.parent {
+		state[current.cell] += int(current.diff)
+	}
 }
 
-func (n *node) getPixelValue(x, y int, startingImage *image.Gray) (ret int) {
-	ret = int(startingImage.GrayAt(x, y).Y)
-	if val, ok := n.diffs[makeNodeDiffKey(x, y)]; ok {
-		ret += val
-	}
-	return
+// make an image with just the single diff, given the image from the parent
+func (n *node) makeImage(prev *image.Gray, grid searchGrid) *image.Gray {
+	return n.applyImage(prev, grid, int(n.diff))
 }
 
-func (n *node) equalsImage(startingImage, goalImage *image.Gray, scale int) (res bool) {
-	return 0 == iterate(startingImage.Bounds(), func(x int, y int, prev int) int {
-		if prev == 0 && int(goalImage.GrayAt(x, y).Y) != n.getPixelValue(x, y, startingImage) {
-			prev = 1
-		}
-		return prev
-	}, scale, 0)
+// make an image with the single diff undone, given the image of this node
+func (n *node) undoImage(prev *image.Gray, grid searchGrid) *image.Gray {
+	return n.applyImage(prev, grid, -int(n.diff))
 }
 
-// make an image with just the single diff, given the image from the parent
-func (n *node) makeImage(prev *image.Gray) *image.Gray {
+func (n *node) applyImage(prev *image.Gray, grid searchGrid, diff int) *image.Gray {
 	result := copyGray(prev)
-	cur := prev.GrayAt(n.x, n.y).Y
-	result.SetGray(n.x, n.y, color.Gray{uint8(int(cur) + n.diff)})
+	x, y := grid.point(int(n.cell))
+	cur := prev.GrayAt(x, y).Y
+	result.SetGray(x, y, color.Gray{uint8(int(cur) + diff)})
 	return result
 }
 
-func makeNodeDiffKey(x, y int) string {
-	return fmt.Sprintf("%d,%d", x, y)
-}
-
+// nodeSet holds nodes by the state they reach. Hashes are 64 bits so
+// distinct states colliding is not a practical concern.
 type nodeSet struct {
-	nodes map[int][]*node
-	size  int
+	nodes map[uint64]*node
 }
 
 func newNodeSet() nodeSet {
-	return nodeSet{map[int][]*node{}, 0}
+	return nodeSet{map[uint64]*node{}}
 }
 
 func (s *nodeSet) add(n *node) {
-	s.size++
-	if val, ok := s.nodes[n.h]; ok {
-		s.nodes[n.h] = append(val, n)
-	} else {
-		s.nodes[n.h] = []*node{n}
+	s.nodes[n.hash] = n
+}
+
+// remove forgets n, if it is the node held for its state
+func (s *nodeSet) remove(n *node) {
+	if s.nodes[n.hash] == n {
+		delete(s.nodes, n.hash)
 	}
 }
 
 func (s *nodeSet) has(n *node) bool {
-	if val, ok := s.nodes[n.h]; ok {
-		for _, node := range val {
-			if n.equals(node) {
-				return true
-			}
-		}
-	}
+	_, ok := s.nodes[n.hash]
+	return ok
+}
 
-	return false
+// get returns the node reaching the state with the given hash, or nil
+func (s *nodeSet) get(hash uint64) *node {
+	return s.nodes[hash]
 }
 
-// Priority queue implemented with a min heap and trree
+// Priority queue implemented with a min heap and trree. Nodes are ordered by
+// the priority the config gives them, lowest first.
 type priorityQueue struct {
-	arr []*node
-	set nodeSet
+	arr    []*node
+	set    nodeSet
+	config AStarConfig
+	added  uint64
 }
 
-func newPriorityQueue() priorityQueue {
-	return priorityQueue{[]*node{}, newNodeSet()}
+func newPriorityQueue(config AStarConfig) priorityQueue {
+	return priorityQueue{[]*node{}, newNodeSet(), config, 0}
+}
+
+// less reports whether a should come off the open list before b
+func (pq *priorityQueue) less(a, b *node) bool {
+	if a.priority != b.priority {
+		return a.priority < b.priority
+	}
+	switch pq.config.TieBreak {
+	case TieBreakFIFO:
+		return a.seq < b.seq
+	case TieBreakLIFO:
+		return a.seq > b.seq
+	}
+	return a.h < b.h
 }
 
 // Add a node to the heap
 func (pq *priorityQueue) add(n *node) {
+	n.priority = pq.config.priority(n)
+	n.seq = pq.added
+	pq.added++
 	pq.arr = append(pq.arr, n)
 	pq.bubbleUp()
 	pq.set.add(n)
@@ -132,7 +217,7 @@ func (pq *priorityQueue) bubbleUp() {
 		element := pq.arr[index]
 		parentIndex := int(math.Floor((float64(index) - 1.0) / 2.0))
 		parent := pq.arr[parentIndex]
-		if parent.h <= element.h {
+		if !pq.less(element, parent) {
 			break
 		}
 
@@ -166,11 +251,11 @@ func (pq *priorityQueue) bubbleDown(index int) {
 	right := left + 1
 	smallest := index
 
-	if left < pq.len() && pq.arr[left].h < pq.arr[smallest].h {
+	if left < pq.len() && pq.less(pq.arr[left], pq.arr[smallest]) {
 		smallest = left
 	}
 
-	if right < pq.len() && pq.arr[right].h < pq.arr[smallest].h {
+	if right < pq.len() && pq.less(pq.arr[right], pq.arr[smallest]) {
 		smallest = right
 	}
 
@@ -192,16 +277,41 @@ func (pq *priorityQueue) doesAllSeenHaveThisNode(n *node) bool {
 	return pq.set.has(n)
 }
 
+// cull evicts the worst nodes until at most the beam width remain. Evicted
+// nodes are forgotten by the seen set so they may be found again later. It
+// waits until the list is twice the width, so the sort is paid for by the
+// many steps since the last cull rather than on every step.
 func (pq *priorityQueue) cull() {
-	if pq.len() < 10 {
-		// already pretty small
+	limit := pq.beamWidth()
+	if limit < 0 || pq.len() <= 2*limit {
 		return
 	}
 
-	nextH := pq.peek().h
+	// A sorted array is also a valid heap
+	sort.Slice(pq.arr, func(i, j int) bool {
+		return pq.less(pq.arr[i], pq.arr[j])
+	})
+	for _, n := range pq.arr[limit:] {
+		pq.set.remove(n)
+	}
+	for i := limit; i < len(pq.arr); i++ {
+		pq.arr[i] = nil
+	}
+	pq.arr = pq.arr[:limit]
+}
+
+// beamWidth is how many nodes the open list may hold, or -1 for no limit
+func (pq *priorityQueue) beamWidth() int {
+	if pq.config.BeamWidth < 0 {
+		return -1
+	}
+	if pq.config.BeamWidth > 0 {
+		return pq.config.BeamWidth
+	}
+	if pq.len() == 0 {
+		return 0
+	}
 
-	// Use nextH to decide how many more nodes to keep
-	limit := math.Max(float64(nextH*5), 500)
-	limit = math.Min(float64(pq.len()), limit)
-	pq.arr = pq.arr[:int(limit)]
+	// Use the next h to decide how many more nodes to keep
+	return maxInt(pq.peek().h*5, 500)
 }
@@ -0,0 +1,231 @@
+package fade
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+)
+
+// A pathStep sets one pixel of the previous frame
+type pathStep struct {
+	x, y  int
+	value uint8
+}
+
+// levelPath is a transition at one level of the pyramid: in and out
+// downsampled by factor, and the steps leading from one to the other
+type levelPath struct {
+	in, out *image.Gray
+	factor  int
+	steps   []pathStep
+}
+
+func newLevelPath(in, out *image.Gray, factor int) levelPath {
+	return levelPath{downsampleGray(in, factor), downsampleGray(out, factor), factor, nil}
+}
+
+// aStarPyramidStream solves the transition with A* on images downsampled by
+// c.Scale, then repeatedly halves the factor, following the coarser path at
+// each finer level until it reaches full resolution. Each search along the way
+// only covers a few pixels, which keeps large images tractable. The path moves
+// one pixel at a time, so it is spread over at most c.NumIterations frames.
+//
+// If ctx is done first, the path of the finest level finished so far is
+// written instead, each step setting the block of pixels under it. Before any
+// level is finished that is the path to the closest node the coarsest search
+// found.
+func aStarPyramidStream(ctx context.Context, in, out *image.Gray, c Config, sink FrameSink) error {
+	factors := pyramidFactors(c.Scale)
+	progress := c.progress()
+	progress.Start("A* pyramid search", len(factors))
+	defer progress.Done()
+
+	in, out = Normalize(in, out, c.Fit)
+	if err := sink.WriteFrame(in); err != nil {
+		return err
+	}
+
+	searchConfig := c
+	searchConfig.Scale = 1
+	searchConfig.Progress = nil
+
+	// The coarsest level is solved outright
+	coarse := newLevelPath(in, out, factors[0])
+	search := newAStarSearch(coarse.in, coarse.out, searchConfig)
+	finalNode, err := search.run(ctx, 1)
+	coarse.steps = search.pathSteps(finalNode)
+	if err != nil {
+		if writeErr := writeSteps(in, coarse, c.NumIterations, sink); writeErr != nil {
+			return writeErr
+		}
+		return err
+	}
+	progress.Update(1)
+
+	// The refining searches are tiny, so their stats are not worth logging
+	searchConfig.Logger = nil
+
+	for i, factor := range factors[1:] {
+		fine := newLevelPath(in, out, factor)
+		emit := func(step pathStep) error {
+			fine.steps = append(fine.steps, step)
+			return nil
+		}
+
+		if err := refineLevel(ctx, coarse, fine, searchConfig, emit); err != nil {
+			if writeErr := writeSteps(in, coarse, c.NumIterations, sink); writeErr != nil {
+				return writeErr
+			}
+			return err
+		}
+		coarse = fine
+		progress.Update(i + 2)
+	}
+
+	return writeSteps(in, coarse, c.NumIterations, sink)
+}
+
+// writeSteps applies the steps of path to in, where each sets the block of
+// pixels under it, and writes a frame after every few so there are at most
+// maxFrames. Zero or less writes a frame for every step.
+func writeSteps(in *image.Gray, path levelPath, maxFrames int, sink FrameSink) error {
+	every := 1
+	if maxFrames > 0 {
+		every = maxInt((len(path.steps)+maxFrames-1)/maxFrames, 1)
+	}
+
+	frame := in
+	for i, step := range path.steps {
+		if i%every == 0 {
+			frame = copyGray(frame)
+		}
+		block := fineBlock(step.x, step.y, path.factor, 1, in.Rect)
+		forEachPixelIn(block, func(x, y int) {
+			frame.SetGray(x, y, color.Gray{step.value})
+		})
+		if (i+1)%every == 0 || i == len(path.steps)-1 {
+			if err := sink.WriteFrame(frame); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pyramidFactors lists the downsampling factor of each level, coarsest first
+func pyramidFactors(scale int) []int {
+	var factors []int
+	for ; scale > 1; scale /= 2 {
+		factors = append(factors, scale)
+	}
+	return append(factors, 1)
+}
+
+// refineLevel follows the coarse path at the finer level of fine, passing
+// each step of the refined path to emit. Every coarse step moves the block of
+// fine pixels under its cell the same fraction of the way from in to out, and
+// a search over that block finds the steps to get there. Blocks the coarse
+// path left unfinished are completed at the end.
+func refineLevel(ctx context.Context, coarse, fine levelPath, c Config, emit func(step pathStep) error) error {
+	cur := copyGray(fine.in)
+	target := copyGray(fine.in)
+
+	for _, step := range coarse.steps {
+		from := float64(coarse.in.GrayAt(step.x, step.y).Y)
+		to := float64(coarse.out.GrayAt(step.x, step.y).Y)
+		t := 0.0
+		if from != to {
+			t = clampFloat((float64(step.value)-from)/(to-from), 0, 1)
+		}
+
+		block := fineBlock(step.x, step.y, coarse.factor, fine.factor, fine.in.Rect)
+		forEachPixelIn(block, func(x, y int) {
+			in, out := float64(fine.in.GrayAt(x, y).Y), float64(fine.out.GrayAt(x, y).Y)
+			target.SetGray(x, y, color.Gray{uint8(math.Round(in + t*(out-in)))})
+		})
+
+		if err := searchSegment(ctx, cur, target, block, c, emit); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	forEachPixelIn(coarse.in.Rect, func(cx, cy int) {
+		if err != nil {
+			return
+		}
+		block := fineBlock(cx, cy, coarse.factor, fine.factor, fine.in.Rect)
+		forEachPixelIn(block, func(x, y int) {
+			target.SetGray(x, y, fine.out.GrayAt(x, y))
+		})
+		err = searchSegment(ctx, cur, target, block, c, emit)
+	})
+	return err
+}
+
+// searchSegment finds the steps taking cur to target within block, where the
+// two must otherwise be identical, and applies them to cur. The search covers
+// a one pixel margin so it can copy from the pixels around the block.
+func searchSegment(ctx context.Context, cur, target *image.Gray, block image.Rectangle, c Config, emit func(step pathStep) error) error {
+	var changed image.Rectangle
+	forEachPixelIn(block, func(x, y int) {
+		if cur.GrayAt(x, y) != target.GrayAt(x, y) {
+			changed = changed.Union(image.Rect(x, y, x+1, y+1))
+		}
+	})
+	if changed.Empty() {
+		return nil
+	}
+
+	region := changed.Inset(-1).Intersect(cur.Rect)
+	from := copyGray(cur.SubImage(region).(*image.Gray))
+	to := copyGray(target.SubImage(region).(*image.Gray))
+
+	search := newAStarSearch(from, to, c)
+	finalNode, err := search.run(ctx, 1)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range search.pathSteps(finalNode) {
+		cur.SetGray(step.x, step.y, color.Gray{step.value})
+		if err := emit(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fineBlock is the block of pixels at the fine factor lying under a pixel at
+// the coarse factor
+func fineBlock(cx, cy, coarseFactor, fineFactor int, bounds image.Rectangle) image.Rectangle {
+	lo := func(c int) int {
+		return (c*coarseFactor + fineFactor - 1) / fineFactor
+	}
+	return image.Rect(lo(cx), lo(cy), lo(cx+1), lo(cy+1)).Intersect(bounds)
+}
+
+// downsampleGray averages each factor x factor block of img into one pixel
+func downsampleGray(img *image.Gray, factor int) *image.Gray {
+	if factor <= 1 {
+		return img
+	}
+
+	w := (img.Rect.Dx() + factor - 1) / factor
+	h := (img.Rect.Dy() + factor - 1) / factor
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+
+	forEachPixel(dst.Rect, func(x, y int) {
+		block := image.Rect(x*factor, y*factor, (x+1)*factor, (y+1)*factor).
+			Add(img.Rect.Min).Intersect(img.Rect)
+		sum, count := 0, 0
+		forEachPixelIn(block, func(px, py int) {
+			sum += int(img.GrayAt(px, py).Y)
+			count++
+		})
+		dst.SetGray(x, y, color.Gray{uint8((sum + count/2) / count)})
+	})
+
+	return dst
+}
@@ -0,0 +1,148 @@
+package fade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"testing"
+	"time"
+)
+
+func sameGray(a, b *image.Gray) bool {
+	return a.Rect == b.Rect && bytes.Equal(a.Pix, b.Pix)
+}
+
+// checkPath checks frames start at in and each changes at most one pixel
+func checkPath(t *testing.T, name string, frames []*image.Gray, in *image.Gray) {
+	t.Helper()
+	if len(frames) == 0 || !sameGray(frames[0], in) {
+		t.Fatalf("%s: path does not start at in", name)
+	}
+	for i := 1; i < len(frames); i++ {
+		changed := 0
+		for j := range frames[i].Pix {
+			if frames[i].Pix[j] != frames[i-1].Pix[j] {
+				changed++
+			}
+		}
+		if changed > 1 {
+			t.Fatalf("%s: frame %d changes %d pixels", name, i, changed)
+		}
+	}
+}
+
+func TestAStarReachesOut(t *testing.T) {
+	in := grayFrame(4, 3, func(x, y int) uint8 { return uint8(100 + x*3 + y) })
+	out := grayFrame(4, 3, func(x, y int) uint8 { return uint8(104 - x - 2*y) })
+
+	for _, tc := range []struct {
+		name   string
+		fn     StreamFunc
+		config Config
+	}{
+		{"astar", AStarStream, Config{Scale: 1}},
+		{"bi-astar", BiAStarStream, Config{Scale: 1}},
+		{"pyramid", AStarStream, Config{Scale: 2, AStar: AStarConfig{Pyramid: true}}},
+	} {
+		frames, err := collect(context.Background(), tc.fn, in, out, tc.config)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if tc.name != "pyramid" {
+			// The pyramid spreads its steps over fewer frames
+			checkPath(t, tc.name, frames, in)
+		}
+		if !sameGray(frames[len(frames)-1], out) {
+			t.Errorf("%s: last frame %v, want %v", tc.name, frames[len(frames)-1].Pix, out.Pix)
+		}
+	}
+}
+
+func TestAStarWorkers(t *testing.T) {
+	// Enough cells for rows to be expanded in parallel, with a few to change
+	const size = 33
+	if size*size < minParallelCells {
+		t.Fatal("grid is too small to expand in parallel")
+	}
+	in := grayFrame(size, size, func(x, y int) uint8 { return uint8(x + y) })
+	out := grayFrame(size, size, func(x, y int) uint8 {
+		if (x == 5 && y == 7) || (x == 20 && y == 30) || (x == 32 && y == 1) {
+			return uint8(x + y + 2)
+		}
+		return uint8(x + y)
+	})
+
+	serial, err := AStar(context.Background(), in, out, Config{Scale: 1, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := AStar(context.Background(), in, out, Config{Scale: 1, Workers: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(serial) != len(parallel) {
+		t.Fatalf("got %d frames with 5 workers, want %d", len(parallel), len(serial))
+	}
+	for i := range serial {
+		if !sameGray(serial[i], parallel[i]) {
+			t.Fatalf("frame %d differs between 1 and 5 workers", i)
+		}
+	}
+	if !sameGray(serial[len(serial)-1], out) {
+		t.Error("last frame is not out")
+	}
+}
+
+func TestAStarCancelled(t *testing.T) {
+	in := grayFrame(8, 8, func(x, y int) uint8 { return 255 })
+	out := grayFrame(8, 8, func(x, y int) uint8 { return uint8(x * 30) })
+
+	for _, tc := range []struct {
+		name string
+		fn   StreamFunc
+	}{
+		{"astar", AStarStream},
+		{"bi-astar", BiAStarStream},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		frames, err := collect(ctx, tc.fn, in, out, Config{Scale: 1})
+		cancel()
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: got %v, want context.DeadlineExceeded", tc.name, err)
+		}
+		checkPath(t, tc.name, frames, in)
+	}
+}
+
+func TestAStarDefaultBeam(t *testing.T) {
+	// Far enough apart that the open list is culled many times
+	in := grayFrame(6, 6, func(x, y int) uint8 { return 255 })
+	out := grayFrame(6, 6, func(x, y int) uint8 { return uint8(x * 40) })
+
+	for _, strategy := range []SearchStrategy{SearchStandard, SearchGreedy} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		frames, err := AStar(ctx, in, out, Config{Scale: 1, AStar: AStarConfig{Strategy: strategy}})
+		cancel()
+
+		if err != nil {
+			t.Errorf("%s: %v", strategy, err)
+			continue
+		}
+		if !sameGray(frames[len(frames)-1], out) {
+			t.Errorf("%s: last frame is not out", strategy)
+		}
+	}
+}
+
+func BenchmarkAStarDefaultBeam(b *testing.B) {
+	in := grayFrame(6, 6, func(x, y int) uint8 { return 255 })
+	out := grayFrame(6, 6, func(x, y int) uint8 { return uint8(x * 40) })
+	for i := 0; i < b.N; i++ {
+		if _, err := AStar(context.Background(), in, out, Config{Scale: 1}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package fade
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"time"
+
+	"github.com/icza/mjpeg"
+)
+
+// MakeAvi is a utility method to encode a sequence of images as a motion jpeg
+// avi, shown according to timing. Frames may be grayscale or color. If
+// encoding fails the partially written file is removed.
+func MakeAvi(filename string, images []image.Image, timing Timing) error {
+	if len(images) == 0 {
+		return ErrNoFrames
+	}
+
+	w := NewAviWriter(filename, timing)
+	for _, frame := range images {
+		if err := w.WriteFrame(frame); err != nil {
+			w.Close()
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+// AviWriter is a FrameSink which encodes frames into a motion jpeg avi as they
+// are written. Frames are delayed by one, or held until Close if timing
+// resamples them. An avi has a fixed frame rate, the timing's FPS rounded, so
+// longer delays repeat a frame and frames shorter than one period may be
+// dropped. As an avi cannot loop, a positive LoopCount plays the frames again
+// on Close. The file is created with the first frame, and every frame must
+// have the same bounds. Close must be called to finish the file; after any
+// error the file is removed.
+type AviWriter struct {
+	filename string
+	fps      int32
+	aw       mjpeg.AviWriter
+	bounds   image.Rectangle
+	buf      bytes.Buffer
+	sched    frameScheduler
+	elapsed  time.Duration // display time of the frames written so far
+	written  int           // the same, in avi frames
+	encoded  []aviFrame    // every frame, when the sequence is repeated
+	err      error
+}
+
+// NewAviWriter prepares an avi to be written to filename
+func NewAviWriter(filename string, timing Timing) *AviWriter {
+	fps := int32(math.Max(math.Round(timing.fps()), 1))
+	a := &AviWriter{filename: filename, fps: fps}
+	a.sched = frameScheduler{timing: timing, encode: a.encode}
+	return a
+}
+
+// WriteFrame appends a frame to the avi
+func (a *AviWriter) WriteFrame(frame image.Image) error {
+	if a.err != nil {
+		return a.err
+	}
+	return a.sched.add(frame)
+}
+
+func (a *AviWriter) encode(frame image.Image, delay time.Duration) error {
+	if a.aw == nil {
+		a.bounds = frame.Bounds()
+		aw, err := mjpeg.New(a.filename, int32(a.bounds.Dx()), int32(a.bounds.Dy()), a.fps)
+		if err != nil {
+			a.err = &Error{OpOpen, a.filename, err}
+			return a.err
+		}
+		a.aw = aw
+	} else if frame.Bounds().Size() != a.bounds.Size() {
+		return a.fail(&Error{OpEncode, a.filename, errFrameSize})
+	}
+
+	a.buf.Reset()
+	if err := jpeg.Encode(&a.buf, frame, nil); err != nil {
+		return a.fail(&Error{OpEncode, a.filename, err})
+	}
+
+	// Round the running total rather than each delay so errors do not add up
+	a.elapsed += delay
+	repeats := int(math.Round(a.elapsed.Seconds()*float64(a.fps))) - a.written
+	if repeats <= 0 {
+		return nil
+	}
+	a.written += repeats
+
+	if a.sched.timing.plays() > 1 {
+		// Keep the frame to play again on Close
+		a.encoded = append(a.encoded, aviFrame{append([]byte(nil), a.buf.Bytes()...), repeats})
+	}
+	return a.addFrame(a.buf.Bytes(), repeats)
+}
+
+// aviFrame is an encoded frame and how many periods it is shown for
+type aviFrame struct {
+	data    []byte
+	repeats int
+}
+
+func (a *AviWriter) addFrame(data []byte, repeats int) error {
+	for i := 0; i < repeats; i++ {
+		if err := a.aw.AddFrame(data); err != nil {
+			return a.fail(&Error{OpWrite, a.filename, err})
+		}
+	}
+	return nil
+}
+
+// Close finishes the avi. It returns ErrNoFrames if nothing was written.
+func (a *AviWriter) Close() error {
+	if a.err != nil {
+		return a.err
+	}
+	if err := a.sched.flush(); err != nil {
+		return err
+	}
+	if a.aw == nil {
+		return ErrNoFrames
+	}
+
+	for i := 1; i < a.sched.timing.plays(); i++ {
+		for _, frame := range a.encoded {
+			if err := a.addFrame(frame.data, frame.repeats); err != nil {
+				return err
+			}
+		}
+	}
+	a.encoded = nil
+
+	err := a.aw.Close()
+	a.aw = nil
+	if err != nil {
+		return a.fail(&Error{OpWrite, a.filename, err})
+	}
+
+	a.err = errors.New("fade: avi writer is closed")
+	return nil
+}
+
+func (a *AviWriter) fail(err error) error {
+	a.err = err
+	if a.aw != nil {
+		a.aw.Close()
+		a.aw = nil
+		os.Remove(a.filename)
+	}
+	return err
+}
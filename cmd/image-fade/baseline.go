@@ -0,0 +1,189 @@
+package fade
+
+import (
+	"context"
+	"image"
+	"math"
+	"math/rand"
+)
+
+func init() {
+	Register(NewTransitioner("crossfade",
+		"Blends linearly from one image to the other", CrossDissolveStream))
+	for _, dir := range []WipeDirection{WipeRight, WipeLeft, WipeDown, WipeUp} {
+		Register(NewTransitioner("wipe-"+dir.String(),
+			"Reveals the output behind an edge moving "+dir.String(), WipeStream(dir)))
+	}
+	Register(NewTransitioner("iris-open",
+		"Reveals the output in a growing circle", IrisStream(true)))
+	Register(NewTransitioner("iris-close",
+		"Hides the input in a shrinking circle", IrisStream(false)))
+	Register(NewTransitioner("dissolve",
+		"Switches pixels to the output one by one in a random order", DissolveStream))
+}
+
+// CrossDissolve blends linearly from in to out over NumIterations frames. It
+// is the simplest transition, as a reference for the others.
+func CrossDissolve(ctx context.Context, in, out *image.Gray, config Config) ([]*image.Gray, error) {
+	return collect(ctx, CrossDissolveStream, in, out, config)
+}
+
+// CrossDissolveStream is the streaming form of CrossDissolve
+var CrossDissolveStream = blendStream("cross-dissolve", func(image.Rectangle, Config) pixelMix {
+	return func(x, y int, t float64) float64 {
+		return t
+	}
+})
+
+// WipeDirection is the way the edge of a wipe travels
+type WipeDirection int
+
+const (
+	WipeRight WipeDirection = iota
+	WipeLeft
+	WipeDown
+	WipeUp
+)
+
+var wipeDirectionNames = map[WipeDirection]string{
+	WipeRight: "right",
+	WipeLeft:  "left",
+	WipeDown:  "down",
+	WipeUp:    "up",
+}
+
+func (d WipeDirection) String() string {
+	if name, ok := wipeDirectionNames[d]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Wipe replaces in with out behind a straight edge crossing the image in the
+// given direction over NumIterations frames
+func Wipe(ctx context.Context, in, out *image.Gray, config Config, dir WipeDirection) ([]*image.Gray, error) {
+	return collect(ctx, WipeStream(dir), in, out, config)
+}
+
+// WipeStream returns the streaming form of Wipe
+func WipeStream(dir WipeDirection) StreamFunc {
+	return blendStream("wipe", func(bounds image.Rectangle, _ Config) pixelMix {
+		w, h := float64(bounds.Dx()), float64(bounds.Dy())
+		return func(x, y int, t float64) float64 {
+			// How far along the pixel is, from 0 to 1
+			var at float64
+			switch dir {
+			case WipeLeft:
+				at = 1 - (float64(x)+0.5)/w
+			case WipeDown:
+				at = (float64(y) + 0.5) / h
+			case WipeUp:
+				at = 1 - (float64(y)+0.5)/h
+			default:
+				at = (float64(x) + 0.5) / w
+			}
+			return step(at, t)
+		}
+	})
+}
+
+// Iris replaces in with out inside a circle around the center, which grows
+// from nothing if open and otherwise shrinks to nothing over NumIterations
+// frames
+func Iris(ctx context.Context, in, out *image.Gray, config Config, open bool) ([]*image.Gray, error) {
+	return collect(ctx, IrisStream(open), in, out, config)
+}
+
+// IrisStream returns the streaming form of Iris
+func IrisStream(open bool) StreamFunc {
+	return blendStream("iris", func(bounds image.Rectangle, _ Config) pixelMix {
+		cx, cy := float64(bounds.Dx())/2, float64(bounds.Dy())/2
+		radius := math.Hypot(cx, cy)
+		return func(x, y int, t float64) float64 {
+			at := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy) / radius
+			if open {
+				return step(at, t)
+			}
+			// The outside, beyond 1-t of the way from the center, shows out
+			return step(1-at, t)
+		}
+	})
+}
+
+// Dissolve switches each pixel from in to out at a random moment, drawn from
+// Config.Seed, over NumIterations frames
+func Dissolve(ctx context.Context, in, out *image.Gray, config Config) ([]*image.Gray, error) {
+	return collect(ctx, DissolveStream, in, out, config)
+}
+
+// DissolveStream is the streaming form of Dissolve
+var DissolveStream = blendStream("dissolve", func(bounds image.Rectangle, config Config) pixelMix {
+	r := rand.New(rand.NewSource(config.Seed))
+	w := bounds.Dx()
+	moments := make([]float64, w*bounds.Dy())
+	for i := range moments {
+		moments[i] = r.Float64()
+	}
+	return func(x, y int, t float64) float64 {
+		return step(moments[y*w+x], t)
+	}
+})
+
+// step is 1 once t has reached at
+func step(at, t float64) float64 {
+	if at < t {
+		return 1
+	}
+	return 0
+}
+
+// A pixelMix says how far a pixel is from in towards out, from 0 to 1, a
+// fraction t of the way through the transition. Coordinates are relative to
+// the image origin.
+type pixelMix func(x, y int, t float64) float64
+
+// blendStream makes a transitioner which writes in, then NumIterations frames
+// mixing in and out pixel by pixel, then out. newMix is called once the
+// images are normalized.
+func blendStream(task string, newMix func(bounds image.Rectangle, config Config) pixelMix) StreamFunc {
+	return func(ctx context.Context, in, out *image.Gray, config Config, sink FrameSink) error {
+		progress := config.progress()
+		progress.Start(task+" transitioner", config.NumIterations)
+		defer progress.Done()
+
+		in, out = Normalize(in, out, config.Fit)
+
+		if err := sink.WriteFrame(in); err != nil {
+			return err
+		}
+
+		mix := newMix(in.Bounds(), config)
+		for i := 1; i <= config.NumIterations; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			t := float64(i) / float64(config.NumIterations+1)
+			if err := sink.WriteFrame(blend(in, out, mix, t, config.Workers)); err != nil {
+				return err
+			}
+			progress.Update(i)
+		}
+
+		return sink.WriteFrame(out)
+	}
+}
+
+func blend(in, out *image.Gray, mix pixelMix, t float64, workers int) *image.Gray {
+	bounds := in.Bounds()
+	frame := image.NewGray(bounds)
+	forEachBand(bounds, workers, func(band image.Rectangle) {
+		forEachPixelIn(band, func(x, y int) {
+			m := mix(x-bounds.Min.X, y-bounds.Min.Y, t)
+			from := float64(in.Pix[in.PixOffset(x, y)])
+			to := float64(out.Pix[out.PixOffset(x, y)])
+			frame.Pix[frame.PixOffset(x, y)] = uint8(math.Round((1-m)*from + m*to))
+		})
+	})
+	return frame
+}
@@ -0,0 +1,32 @@
+package fade
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIris(t *testing.T) {
+	in := grayFrame(21, 15, func(x, y int) uint8 { return 10 })
+	out := grayFrame(21, 15, func(x, y int) uint8 { return 200 })
+	config := Config{NumIterations: 9}
+
+	for _, open := range []bool{true, false} {
+		frames, err := Iris(context.Background(), in, out, config, open)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Partway through, an opening iris shows out in the middle and a
+		// closing one still shows in there, and the reverse at the corners
+		mid := frames[len(frames)/2]
+		center, corner := mid.GrayAt(10, 7).Y, mid.GrayAt(0, 0).Y
+		wantCenter, wantCorner := uint8(10), uint8(200)
+		if open {
+			wantCenter, wantCorner = 200, 10
+		}
+		if center != wantCenter || corner != wantCorner {
+			t.Errorf("open %v: center %d and corner %d, want %d and %d",
+				open, center, corner, wantCenter, wantCorner)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package fade
+
+import (
+	"context"
+	"image"
+)
+
+func init() {
+	Register(NewTransitioner("bi-astar",
+		"Searches with A* from both images at once until the searches meet (slow)", BiAStarStream))
+}
+
+// BiAStar runs one A* search from in towards out and another from out towards
+// in, alternating between them until one reaches a state the other has seen.
+// The two paths are then joined into one.
+func BiAStar(ctx context.Context, in, out *image.Gray, c Config) ([]*image.Gray, error) {
+	return collect(ctx, BiAStarStream, in, out, c)
+}
+
+// BiAStarStream is the streaming form of BiAStar. Frames are produced once the
+// searches have met. If ctx is done first, the path to the node of the
+// forward search closest to out is written and ctx.Err() returned.
+func BiAStarStream(ctx context.Context, in, out *image.Gray, c Config, sink FrameSink) error {
+	progress := c.progress()
+	progress.Start("bidirectional A* search", 0)
+	defer progress.Done()
+
+	in, out = Normalize(in, out, c.Fit)
+
+	// Only the forward search reports progress, the total is reported here
+	backwardConfig := c
+	backwardConfig.Progress = nil
+
+	forward := newAStarSearch(in, out, c)
+	backward := newAStarSearch(out, in, backwardConfig)
+	forward.other = &backward.open.set
+	backward.other = &forward.open.set
+
+	forwardNode, backwardNode, err := runBidirectional(ctx, &forward, &backward, progress)
+	if err != nil {
+		if pathErr := forward.writePath(forward.best, sink); pathErr != nil {
+			return pathErr
+		}
+		return err
+	}
+
+	return forward.writeJoinedPath(forwardNode, backwardNode, sink)
+}
+
+// runBidirectional alternates steps of the two searches until they meet. It
+// returns the node from each search which reaches the meeting state.
+func runBidirectional(ctx context.Context, forward, backward *aStarSearch, progress Progress) (*node, *node, error) {
+	if forward.best.h == 0 {
+		// Already there
+		return forward.root, backward.root, nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		if finalNode := forward.step(); finalNode != nil {
+			if forward.met != nil {
+				return finalNode, forward.met, nil
+			}
+			return finalNode, backward.root, nil
+		}
+
+		if finalNode := backward.step(); finalNode != nil {
+			if backward.met != nil {
+				return backward.met, finalNode, nil
+			}
+			return forward.root, finalNode, nil
+		}
+
+		forward.report(1)
+		backward.report(1)
+		progress.Update(forward.stats.numProcessed + backward.stats.numProcessed)
+	}
+}
+
+// writeJoinedPath writes the path to forwardNode, then walks back up the path
+// of the opposite search from backwardNode, undoing each of its diffs.
+// Both nodes must reach the same state.
+func (a *aStarSearch) writeJoinedPath(forwardNode, backwardNode *node, sink FrameSink) error {
+	var path []*node
+	for currentNode := forwardNode; currentNode.parent != nil; currentNode = currentNode.parent {
+		path = append(path, currentNode)
+	}
+
+	lastImage := a.originalInput
+	if err := sink.WriteFrame(lastImage); err != nil {
+		return err
+	}
+
+	for i := len(path) - 1; i >= 0; i-- {
+		lastImage = path[i].makeImage(lastImage, a.grid)
+		if err := sink.WriteFrame(lastImage); err != nil {
+			return err
+		}
+	}
+
+	for currentNode := backwardNode; currentNode.parent != nil; currentNode = currentNode.parent {
+		lastImage = currentNode.undoImage(lastImage, a.grid)
+		if err := sink.WriteFrame(lastImage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,26 +1,40 @@
 package fade
 
 import (
-	"fmt"
+	"context"
 	"image"
-	"time"
 )
 
 const (
 	minChangePercentage = 0.15
 )
 
+func init() {
+	Register(NewTransitioner("bi-iterative",
+		"Iterates from both images at once to meet in the middle", BiIterativeStream))
+}
+
 // BiIterative is similar to the iterative algorithm, however this one works
 // from both the beginning and ending image to meet in the middle
-func BiIterative(in, out *image.Gray, config Config) []*image.Gray {
-	defer timeTrack(time.Now(), "bidirectional iterative transitioner")
+func BiIterative(ctx context.Context, in, out *image.Gray, config Config) ([]*image.Gray, error) {
+	return collect(ctx, BiIterativeStream, in, out, config)
+}
 
-	fmt.Println("Running bidirectional iterative")
+// BiIterativeStream is the streaming form of BiIterative. The forward half is
+// streamed as it is generated, but the backward half has to be held until the
+// two meet since it is played in reverse.
+func BiIterativeStream(ctx context.Context, in, out *image.Gray, config Config, sink FrameSink) error {
+	progress := config.progress()
+	progress.Start("bidirectional iterative transitioner", config.NumIterations)
+	defer progress.Done()
+
+	in, out = Normalize(in, out, config.Fit)
 
-	var forwardImages []*image.Gray
 	var backwardImages []*image.Gray
 
-	forwardImages = append(forwardImages, in)
+	if err := sink.WriteFrame(in); err != nil {
+		return err
+	}
 	backwardImages = append(backwardImages, out)
 
 	nextFrameForward := in
@@ -28,29 +42,33 @@ func BiIterative(in, out *image.Gray, config Config) []*image.Gray {
 
 	minChanged := int(minChangePercentage * float32(in.Bounds().Dx()*in.Bounds().Dy()))
 	var numChanges int
-	fmt.Println()
 
 	for i := 0; i < config.NumIterations; i++ {
-		nextFrameForward, numChanges = getNextImage(nextFrameForward, nextFrameBackward)
-		forwardImages = append(forwardImages, nextFrameForward)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		nextFrameForward, numChanges = getNextImage(nextFrameForward, nextFrameBackward, config.Workers)
+		if err := sink.WriteFrame(nextFrameForward); err != nil {
+			return err
+		}
 		if numChanges < minChanged {
 			break
 		}
 
-		nextFrameBackward, numChanges = getNextImage(nextFrameBackward, nextFrameForward)
+		nextFrameBackward, numChanges = getNextImage(nextFrameBackward, nextFrameForward, config.Workers)
 		backwardImages = append(backwardImages, nextFrameBackward)
 		if numChanges < minChanged {
 			break
 		}
 
-		printStatus(i+1, config.NumIterations)
+		progress.Update(i + 1)
 	}
 
-	reverseSlice(backwardImages)
-
-	images := append(forwardImages, backwardImages...)
-
-	fmt.Println("\r")
-	fmt.Println()
-	return images
+	for i := len(backwardImages) - 1; i >= 0; i-- {
+		if err := sink.WriteFrame(backwardImages[i]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
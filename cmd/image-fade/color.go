@@ -0,0 +1,204 @@
+package fade
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"sync"
+)
+
+const (
+	numChannels = 4
+)
+
+// RunRGBA runs any transitioner on each color channel. If ctx is cancelled
+// the frames made so far are returned along with ctx.Err().
+func RunRGBA(ctx context.Context, t Transitioner, in, out *image.RGBA, config Config) ([]*image.RGBA, error) {
+	return collectRGBA(ctx, t.Stream, in, out, config)
+}
+
+// StreamRGBA runs any transitioner on each color channel, streaming the
+// recombined frames to the sink
+func StreamRGBA(ctx context.Context, t Transitioner, in, out *image.RGBA, config Config, sink FrameSink) error {
+	return perChannel(ctx, t.Stream, in, out, config, sink)
+}
+
+// IterativeRGBA runs the iterative transitioner on each color channel
+func IterativeRGBA(ctx context.Context, in, out *image.RGBA, config Config) ([]*image.RGBA, error) {
+	return collectRGBA(ctx, IterativeStream, in, out, config)
+}
+
+// BiIterativeRGBA runs the bidirectional iterative transitioner on each color
+// channel
+func BiIterativeRGBA(ctx context.Context, in, out *image.RGBA, config Config) ([]*image.RGBA, error) {
+	return collectRGBA(ctx, BiIterativeStream, in, out, config)
+}
+
+// AStarRGBA runs the A* transitioner on each color channel
+func AStarRGBA(ctx context.Context, in, out *image.RGBA, config Config) ([]*image.RGBA, error) {
+	return collectRGBA(ctx, AStarStream, in, out, config)
+}
+
+// FramesRGBA converts a color transition into generic frames for encoding
+func FramesRGBA(images []*image.RGBA) []image.Image {
+	frames := make([]image.Image, len(images))
+	for i, img := range images {
+		frames[i] = img
+	}
+	return frames
+}
+
+func collectRGBA(ctx context.Context, fn StreamFunc, in, out *image.RGBA, config Config) ([]*image.RGBA, error) {
+	c := &rgbaCollector{}
+	err := perChannel(ctx, fn, in, out, config, c)
+	return c.frames, err
+}
+
+// perChannel steps each of the red, green, blue and alpha channels
+// independently (and concurrently) with a grayscale transitioner, then
+// recombines them frame by frame. A channel which finishes in fewer frames
+// holds its last frame.
+func perChannel(ctx context.Context, fn StreamFunc, in, out *image.RGBA, config Config, sink FrameSink) error {
+	inChannels := splitChannels(in)
+	outChannels := splitChannels(out)
+
+	// Cancelled when the sink fails so the channels stop early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var frames [numChannels]chan *image.Gray
+	var errs [numChannels]error
+	var wg sync.WaitGroup
+
+	// Only the first channel reports progress
+	channelConfig := config
+
+	for c := range frames {
+		// Letterboxing should stay opaque
+		var fill uint8
+		if c == 3 {
+			fill = 255
+		}
+		inChannels[c], outChannels[c] = normalize(inChannels[c], outChannels[c], config.Fit, fill)
+
+		frames[c] = make(chan *image.Gray, 1)
+		if equalGray(inChannels[c], outChannels[c]) {
+			// Nothing to do (typically alpha)
+			frames[c] <- inChannels[c]
+			close(frames[c])
+			continue
+		}
+
+		wg.Add(1)
+		go func(c int, config Config) {
+			defer wg.Done()
+			defer close(frames[c])
+			errs[c] = fn(ctx, inChannels[c], outChannels[c], config, FrameSinkFunc(func(frame image.Image) error {
+				select {
+				case frames[c] <- ToGrayscale(frame):
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}))
+		}(c, channelConfig)
+		channelConfig.Progress = nil
+	}
+
+	err := mergeFrames(ctx, frames, &errs, sink)
+	cancel()
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeFrames takes the next frame from each channel until all are finished.
+// Nothing is merged until every channel has sent its first frame; if one
+// finishes without any, its error is returned instead.
+func mergeFrames(ctx context.Context, frames [numChannels]chan *image.Gray, errs *[numChannels]error, sink FrameSink) error {
+	var last [numChannels]*image.Gray
+	for {
+		received := false
+		for c, ch := range frames {
+			if frame, ok := <-ch; ok {
+				last[c] = frame
+				received = true
+			} else if last[c] == nil {
+				// The channel is closed, so its error is set
+				if errs[c] != nil {
+					return errs[c]
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				return ErrNoFrames
+			}
+		}
+
+		if !received {
+			return nil
+		}
+
+		if err := sink.WriteFrame(mergeChannels(last)); err != nil {
+			return err
+		}
+	}
+}
+
+func splitChannels(img *image.RGBA) (channels [numChannels]*image.Gray) {
+	for c := range channels {
+		channels[c] = image.NewGray(img.Rect)
+	}
+
+	forEachPixel(img.Rect, func(x, y int) {
+		px := img.RGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+		for c, v := range [numChannels]uint8{px.R, px.G, px.B, px.A} {
+			channels[c].SetGray(img.Rect.Min.X+x, img.Rect.Min.Y+y, color.Gray{v})
+		}
+	})
+
+	return
+}
+
+// mergeChannels is the inverse of splitChannels. Colors are clamped to alpha
+// since the channels are stepped independently but RGBA is premultiplied.
+func mergeChannels(channels [numChannels]*image.Gray) *image.RGBA {
+	bounds := channels[0].Rect
+	img := image.NewRGBA(bounds)
+
+	forEachPixel(bounds, func(x, y int) {
+		x, y = bounds.Min.X+x, bounds.Min.Y+y
+		a := channels[3].GrayAt(x, y).Y
+		px := color.RGBA{A: a}
+		for c, v := range []*uint8{&px.R, &px.G, &px.B} {
+			*v = channels[c].GrayAt(x, y).Y
+			if *v > a {
+				*v = a
+			}
+		}
+		img.SetRGBA(x, y, px)
+	})
+
+	return img
+}
+
+func equalGray(a, b *image.Gray) bool {
+	if a.Rect != b.Rect {
+		return false
+	}
+
+	return 0 == iterate(a.Rect, func(x, y, prev int) int {
+		if prev == 0 && a.GrayAt(a.Rect.Min.X+x, a.Rect.Min.Y+y) != b.GrayAt(b.Rect.Min.X+x, b.Rect.Min.Y+y) {
+			prev = 1
+		}
+		return prev
+	}, 1, 0)
+}
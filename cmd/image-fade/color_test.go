@@ -0,0 +1,83 @@
+package fade
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"sync"
+	"testing"
+)
+
+func testRGBA(w, h int, value func(x, y int) color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	forEachPixel(img.Rect, func(x, y int) {
+		img.SetRGBA(x, y, value(x, y))
+	})
+	return img
+}
+
+// endless writes frames until ctx is cancelled, calling written after each
+func endless(written func()) Transitioner {
+	return NewTransitioner("endless", "", func(ctx context.Context, in, out *image.Gray, config Config, sink FrameSink) error {
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := sink.WriteFrame(in); err != nil {
+				return err
+			}
+			written()
+		}
+	})
+}
+
+func TestRunRGBACancelled(t *testing.T) {
+	in := testRGBA(6, 5, func(x, y int) color.RGBA { return color.RGBA{10, 20, 30, 255} })
+	out := testRGBA(6, 5, func(x, y int) color.RGBA { return color.RGBA{200, 100, 50, 255} })
+	config := Config{NumIterations: 5}
+
+	t.Run("before", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		for _, tr := range []Transitioner{endless(func() {}), NewTransitioner("iterative", "", IterativeStream)} {
+			frames, err := RunRGBA(ctx, tr, in, out, config)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: got %v, want context.Canceled", tr.Name(), err)
+			}
+			for i, frame := range frames {
+				if frame == nil || frame.Rect != in.Rect {
+					t.Errorf("%s: frame %d is incomplete", tr.Name(), i)
+				}
+			}
+		}
+	})
+
+	t.Run("during", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var mu sync.Mutex
+		count := 0
+		frames, err := RunRGBA(ctx, endless(func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if count++; count == 20 {
+				cancel()
+			}
+		}), in, out, config)
+
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want context.Canceled", err)
+		}
+		if len(frames) == 0 {
+			t.Error("got no frames from before the cancellation")
+		}
+		for i, frame := range frames {
+			if frame == nil || frame.Rect != in.Rect {
+				t.Errorf("frame %d is incomplete", i)
+			}
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package fade
+
+import (
+	"errors"
+	"os"
+)
+
+// Op describes the stage of loading or saving an image that failed
+type Op string
+
+// The stages reported in an Error
+const (
+	OpOpen   Op = "open"
+	OpDecode Op = "decode"
+	OpEncode Op = "encode"
+	OpWrite  Op = "write"
+)
+
+// ErrNoFrames is returned when asked to encode an empty sequence of frames
+var ErrNoFrames = errors.New("fade: no frames to encode")
+
+// Error records a failure reading or writing a file, along with the stage
+// that failed. Use errors.As to inspect it and errors.Is to match the
+// underlying cause.
+type Error struct {
+	Op   Op
+	Path string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return "fade: " + string(e.Op) + ": " + e.Err.Error()
+	}
+
+	// The os package already names the file, so don't repeat it
+	cause := e.Err
+	var pathErr *os.PathError
+	if errors.As(cause, &pathErr) && pathErr.Path == e.Path {
+		cause = pathErr.Err
+	}
+	return "fade: " + string(e.Op) + " " + e.Path + ": " + cause.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,220 @@
+package fade
+
+import (
+	"context"
+	"image"
+	"math"
+	"sort"
+)
+
+const (
+	flowBlockSize  = 8   // pixels per side of each matched block
+	flowMotionCost = 0.1 // added to a block's mean difference per pixel moved
+)
+
+func init() {
+	Register(NewTransitioner("flow",
+		"Estimates where structure moves between the images and morphs along it", FlowStream))
+}
+
+// Flow estimates a dense displacement field from in to out by block matching,
+// then makes NumIterations frames which move the pixels of in along it while
+// they blend into out, like a morph. Scale above one only tries every
+// Scale-th displacement, making the estimate faster but coarser.
+func Flow(ctx context.Context, in, out *image.Gray, config Config) ([]*image.Gray, error) {
+	return collect(ctx, FlowStream, in, out, config)
+}
+
+// FlowStream is the streaming form of Flow
+func FlowStream(ctx context.Context, in, out *image.Gray, config Config, sink FrameSink) error {
+	progress := config.progress()
+	progress.Start("optical flow transitioner", config.NumIterations)
+	defer progress.Done()
+
+	in, out = Normalize(in, out, config.Fit)
+
+	if err := sink.WriteFrame(in); err != nil {
+		return err
+	}
+
+	field, err := estimateFlow(ctx, in, out, config.Scale, config.Workers)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= config.NumIterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		t := float64(i) / float64(config.NumIterations+1)
+		if err := sink.WriteFrame(field.morph(in, out, t, config.Workers)); err != nil {
+			return err
+		}
+		progress.Update(i)
+	}
+
+	return sink.WriteFrame(out)
+}
+
+// flowField holds one displacement from in to out per block, interpolated
+// between block centers
+type flowField struct {
+	w, h   int // size in blocks
+	vx, vy []float64
+}
+
+// estimateFlow matches each block of in against out within a search radius
+// which grows with the image, then smooths out stray vectors with a median.
+// It gives up between blocks once ctx is done.
+func estimateFlow(ctx context.Context, in, out *image.Gray, stride, workers int) (flowField, error) {
+	if stride < 1 {
+		stride = 1
+	}
+	bounds := in.Bounds()
+	radius := maxInt(4, minInt(minInt(bounds.Dx(), bounds.Dy())/10, 24))
+
+	f := flowField{
+		w: (bounds.Dx() + flowBlockSize - 1) / flowBlockSize,
+		h: (bounds.Dy() + flowBlockSize - 1) / flowBlockSize,
+	}
+	f.vx = make([]float64, f.w*f.h)
+	f.vy = make([]float64, f.w*f.h)
+	offsets := searchOffsets(radius, stride)
+
+	forEachBand(image.Rect(0, 0, f.w, f.h), workers, func(band image.Rectangle) {
+		for by := band.Min.Y; by < band.Max.Y; by++ {
+			for bx := band.Min.X; bx < band.Max.X && ctx.Err() == nil; bx++ {
+				block := image.Rect(bx, by, bx+1, by+1)
+				block.Min = block.Min.Mul(flowBlockSize).Add(bounds.Min)
+				block.Max = block.Max.Mul(flowBlockSize).Add(bounds.Min)
+				block = block.Intersect(bounds)
+				dx, dy := matchBlock(in, out, block, offsets)
+				f.vx[by*f.w+bx], f.vy[by*f.w+bx] = float64(dx), float64(dy)
+			}
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return f, err
+	}
+
+	return f.smooth(), nil
+}
+
+// searchOffsets lists the displacements to try along each axis, every
+// stride-th one outwards from zero up to radius
+func searchOffsets(radius, stride int) []int {
+	offsets := []int{0}
+	for d := stride; d <= radius; d += stride {
+		offsets = append(offsets, -d, d)
+	}
+	return offsets
+}
+
+// matchBlock finds the displacement of block by offsets along each axis which
+// best matches out, preferring shorter moves when the difference is similar
+func matchBlock(in, out *image.Gray, block image.Rectangle, offsets []int) (int, int) {
+	bounds := in.Bounds()
+	bestX, bestY := 0, 0
+	bestCost := math.Inf(1)
+
+	for _, dy := range offsets {
+		for _, dx := range offsets {
+			// Only compare where the moved block is still in the image, and
+			// only if most of it is
+			moved := block.Add(image.Pt(dx, dy)).Intersect(bounds)
+			if moved.Dx()*moved.Dy()*2 < block.Dx()*block.Dy() {
+				continue
+			}
+
+			sum := 0
+			forEachPixelIn(moved, func(x, y int) {
+				sum += abs(int(in.GrayAt(x-dx, y-dy).Y) - int(out.GrayAt(x, y).Y))
+			})
+			cost := float64(sum)/float64(moved.Dx()*moved.Dy()) +
+				flowMotionCost*math.Hypot(float64(dx), float64(dy))
+
+			if cost < bestCost {
+				bestCost, bestX, bestY = cost, dx, dy
+			}
+		}
+	}
+	return bestX, bestY
+}
+
+// smooth replaces each vector with the median of the 3x3 blocks around it
+func (f flowField) smooth() flowField {
+	smoothed := flowField{f.w, f.h, make([]float64, len(f.vx)), make([]float64, len(f.vy))}
+	var xs, ys []float64
+	for by := 0; by < f.h; by++ {
+		for bx := 0; bx < f.w; bx++ {
+			xs, ys = xs[:0], ys[:0]
+			for y := maxInt(by-1, 0); y <= minInt(by+1, f.h-1); y++ {
+				for x := maxInt(bx-1, 0); x <= minInt(bx+1, f.w-1); x++ {
+					xs = append(xs, f.vx[y*f.w+x])
+					ys = append(ys, f.vy[y*f.w+x])
+				}
+			}
+			smoothed.vx[by*f.w+bx] = median(xs)
+			smoothed.vy[by*f.w+bx] = median(ys)
+		}
+	}
+	return smoothed
+}
+
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	return values[len(values)/2]
+}
+
+// at interpolates the displacement at a pixel relative to the image origin
+func (f flowField) at(x, y int) (float64, float64) {
+	// Block centers sit half a block in
+	fx := clampFloat((float64(x)+0.5)/flowBlockSize-0.5, 0, float64(f.w-1))
+	fy := clampFloat((float64(y)+0.5)/flowBlockSize-0.5, 0, float64(f.h-1))
+	x0, y0 := int(fx), int(fy)
+	x1, y1 := minInt(x0+1, f.w-1), minInt(y0+1, f.h-1)
+	tx, ty := fx-float64(x0), fy-float64(y0)
+
+	lerp := func(v []float64) float64 {
+		top := v[y0*f.w+x0]*(1-tx) + v[y0*f.w+x1]*tx
+		bottom := v[y1*f.w+x0]*(1-tx) + v[y1*f.w+x1]*tx
+		return top*(1-ty) + bottom*ty
+	}
+	return lerp(f.vx), lerp(f.vy)
+}
+
+// morph makes the frame a fraction t of the way along: each pixel blends in,
+// pulled back along the flow, with out, pushed forward along the rest of it
+func (f flowField) morph(in, out *image.Gray, t float64, workers int) *image.Gray {
+	bounds := in.Bounds()
+	frame := image.NewGray(bounds)
+
+	forEachBand(bounds, workers, func(band image.Rectangle) {
+		forEachPixelIn(band, func(x, y int) {
+			vx, vy := f.at(x-bounds.Min.X, y-bounds.Min.Y)
+			from := sampleGray(in, float64(x)-t*vx, float64(y)-t*vy)
+			to := sampleGray(out, float64(x)+(1-t)*vx, float64(y)+(1-t)*vy)
+			frame.Pix[frame.PixOffset(x, y)] = uint8(math.Round((1-t)*from + t*to))
+		})
+	})
+	return frame
+}
+
+// sampleGray reads img at a fractional position with bilinear interpolation,
+// clamping to the edges
+func sampleGray(img *image.Gray, x, y float64) float64 {
+	r := img.Rect
+	x = clampFloat(x, float64(r.Min.X), float64(r.Max.X-1))
+	y = clampFloat(y, float64(r.Min.Y), float64(r.Max.Y-1))
+	x0, y0 := int(x), int(y)
+	x1, y1 := minInt(x0+1, r.Max.X-1), minInt(y0+1, r.Max.Y-1)
+	tx, ty := x-float64(x0), y-float64(y0)
+
+	at := func(x, y int) float64 {
+		return float64(img.Pix[img.PixOffset(x, y)])
+	}
+	top := at(x0, y0)*(1-tx) + at(x1, y0)*tx
+	bottom := at(x0, y1)*(1-tx) + at(x1, y1)*tx
+	return top*(1-ty) + bottom*ty
+}
@@ -0,0 +1,39 @@
+package fade
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFlowCancelled(t *testing.T) {
+	in := grayFrame(600, 400, func(x, y int) uint8 { return uint8(x ^ y) })
+	out := grayFrame(600, 400, func(x, y int) uint8 { return uint8(x * y) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := Flow(ctx, in, out, Config{NumIterations: 5, Workers: 1})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("took %v to stop", elapsed)
+	}
+}
+
+func TestSearchOffsetsIncludeZero(t *testing.T) {
+	for _, stride := range []int{1, 3, 5, 7} {
+		offsets := searchOffsets(24, stride)
+		if offsets[0] != 0 {
+			t.Errorf("stride %d: offsets %v do not start at zero", stride, offsets)
+		}
+		for _, d := range offsets {
+			if d%stride != 0 || abs(d) > 24 {
+				t.Errorf("stride %d: unexpected offset %d", stride, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package fade
+
+import (
+	"bufio"
+	"compress/lzw"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	gifDelayUnit   = 10 * time.Millisecond
+	gifLitWidth    = 8 // bits per palette index
+	gifPaletteSize = 1 << gifLitWidth
+)
+
+var errFrameSize = errors.New("frame size does not match the first frame")
+
+// MakeGif is a utility method to convert a sequence of images and save it as
+// a gif. Grayscale frames are encoded exactly with a gray palette, color
+// frames are dithered onto the Plan9 palette. If encoding fails the partially
+// written file is removed. Frames are shown according to timing.
+func MakeGif(filename string, images []image.Image, timing Timing) error {
+	if len(images) == 0 {
+		return ErrNoFrames
+	}
+
+	w := NewGifWriter(filename, timing)
+	for _, frame := range images {
+		if err := w.WriteFrame(frame); err != nil {
+			w.Close()
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+// GifWriter is a FrameSink which encodes frames into a gif file as they are
+// written, looping as the timing's LoopCount says. Frames are delayed by one,
+// or held until Close if timing resamples them. The file is created with the
+// first frame, and every frame must have the same bounds. Close must be called
+// to finish the file; after any error the file is removed.
+type GifWriter struct {
+	filename string
+	file     *os.File
+	buf      *bufio.Writer
+	w        *latchWriter
+	bounds   image.Rectangle
+	global   color.Palette
+	sched    frameScheduler
+	elapsed  time.Duration // display time of the frames written so far
+	written  int           // the same, in gif delay units
+	err      error
+}
+
+// NewGifWriter prepares a gif to be written to filename
+func NewGifWriter(filename string, timing Timing) *GifWriter {
+	g := &GifWriter{filename: filename}
+	g.sched = frameScheduler{timing: timing, encode: g.encode}
+	return g
+}
+
+// WriteFrame appends a frame to the gif
+func (g *GifWriter) WriteFrame(frame image.Image) error {
+	if g.err != nil {
+		return g.err
+	}
+	return g.sched.add(frame)
+}
+
+func (g *GifWriter) encode(frame image.Image, delay time.Duration) error {
+	paletted := toPaletted(frame)
+	if g.file == nil {
+		if err := g.start(paletted); err != nil {
+			return g.fail(err)
+		}
+	} else if paletted.Rect.Size() != g.bounds.Size() {
+		return g.fail(&Error{OpEncode, g.filename, errFrameSize})
+	}
+
+	// Round the running total rather than each delay so errors do not add up
+	g.elapsed += delay
+	units := maxInt(int((g.elapsed+gifDelayUnit/2)/gifDelayUnit)-g.written, 1)
+	units = minInt(units, 0xffff)
+	g.written += units
+
+	if err := g.writeFrame(paletted, units); err != nil {
+		return g.fail(&Error{OpWrite, g.filename, err})
+	}
+	if err := g.buf.Flush(); err != nil {
+		return g.fail(&Error{OpWrite, g.filename, err})
+	}
+	return nil
+}
+
+// Close finishes the gif. It returns ErrNoFrames if nothing was written.
+func (g *GifWriter) Close() error {
+	if g.err != nil {
+		return g.err
+	}
+	if err := g.sched.flush(); err != nil {
+		return err
+	}
+	if g.file == nil {
+		return ErrNoFrames
+	}
+
+	g.w.bytes(0x3b) // trailer
+	err := g.w.err
+	if err == nil {
+		err = g.buf.Flush()
+	}
+	if closeErr := g.file.Close(); err == nil {
+		err = closeErr
+	}
+	g.file = nil
+
+	if err != nil {
+		return g.fail(&Error{OpWrite, g.filename, err})
+	}
+
+	g.err = errors.New("fade: gif writer is closed")
+	return nil
+}
+
+func (g *GifWriter) fail(err error) error {
+	g.err = err
+	if g.file != nil {
+		g.file.Close()
+		g.file = nil
+		os.Remove(g.filename)
+	}
+	return err
+}
+
+// start creates the file and writes the header. The first frame's palette
+// becomes the global color table.
+func (g *GifWriter) start(first *image.Paletted) error {
+	f, err := os.OpenFile(g.filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return &Error{OpOpen, g.filename, err}
+	}
+
+	g.file = f
+	g.buf = bufio.NewWriter(f)
+	g.w = &latchWriter{w: g.buf}
+	g.bounds = first.Rect
+	g.global = first.Palette
+
+	g.w.string("GIF89a")
+	g.w.uint16(g.bounds.Dx())
+	g.w.uint16(g.bounds.Dy())
+	// Global color table present, 8 bit color resolution, 256 entries
+	g.w.bytes(0xf7, 0x00, 0x00)
+	g.w.palette(g.global)
+
+	// Without the looping extension the animation plays once
+	if loops := g.sched.timing.LoopCount; loops >= 0 {
+		g.w.bytes(0x21, 0xff, 0x0b)
+		g.w.string("NETSCAPE2.0")
+		g.w.bytes(0x03, 0x01)
+		g.w.uint16(minInt(loops, 0xffff))
+		g.w.bytes(0x00)
+	}
+
+	if g.w.err != nil {
+		return &Error{OpWrite, g.filename, g.w.err}
+	}
+	return nil
+}
+
+func (g *GifWriter) writeFrame(frame *image.Paletted, delay int) error {
+	// Graphic control extension with the frame delay
+	g.w.bytes(0x21, 0xf9, 0x04, 0x00)
+	g.w.uint16(delay)
+	g.w.bytes(0x00, 0x00)
+
+	// Image descriptor, with a local color table if the palette differs
+	g.w.bytes(0x2c)
+	g.w.uint16(0)
+	g.w.uint16(0)
+	g.w.uint16(frame.Rect.Dx())
+	g.w.uint16(frame.Rect.Dy())
+	if samePalette(frame.Palette, g.global) {
+		g.w.bytes(0x00)
+	} else {
+		g.w.bytes(0x87)
+		g.w.palette(frame.Palette)
+	}
+
+	g.w.bytes(gifLitWidth)
+	bw := &blockWriter{w: g.w}
+	lw := lzw.NewWriter(bw, lzw.LSB, gifLitWidth)
+	var err error
+	for y := frame.Rect.Min.Y; y < frame.Rect.Max.Y && err == nil; y++ {
+		i := frame.PixOffset(frame.Rect.Min.X, y)
+		_, err = lw.Write(frame.Pix[i : i+frame.Rect.Dx()])
+	}
+	if closeErr := lw.Close(); err == nil {
+		err = closeErr
+	}
+	bw.close()
+
+	if err != nil {
+		return err
+	}
+	return g.w.err
+}
+
+// latchWriter keeps the first error from writing to w and skips any writes
+// after it, so a run of writes only needs checking once at the end
+type latchWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (l *latchWriter) Write(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	var n int
+	n, l.err = l.w.Write(p)
+	return n, l.err
+}
+
+func (l *latchWriter) bytes(p ...byte) {
+	if l.err == nil {
+		_, l.err = l.w.Write(p)
+	}
+}
+
+func (l *latchWriter) string(s string) {
+	l.bytes([]byte(s)...)
+}
+
+func (l *latchWriter) uint16(v int) {
+	l.bytes(uint8(v), uint8(v>>8))
+}
+
+// palette writes a color table padded to the full 256 entries
+func (l *latchWriter) palette(p color.Palette) {
+	for i := 0; i < gifPaletteSize; i++ {
+		var r, g, b uint32
+		if i < len(p) {
+			r, g, b, _ = p[i].RGBA()
+		}
+		l.bytes(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+	}
+}
+
+// blockWriter splits data into the length prefixed sub-blocks used by gif
+type blockWriter struct {
+	w   *latchWriter
+	buf [256]byte
+	n   int
+}
+
+func (b *blockWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		b.n++
+		b.buf[b.n] = c
+		if b.n == 255 {
+			b.flush()
+		}
+	}
+	return len(p), b.w.err
+}
+
+func (b *blockWriter) flush() {
+	b.buf[0] = uint8(b.n)
+	b.w.bytes(b.buf[:b.n+1]...)
+	b.n = 0
+}
+
+// close writes any remaining data and the block terminator
+func (b *blockWriter) close() {
+	if b.n > 0 {
+		b.flush()
+	}
+	b.w.bytes(0x00)
+}
+
+func samePalette(a, b color.Palette) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+var grayPalette = func() color.Palette {
+	p := make(color.Palette, gifPaletteSize)
+	for i := range p {
+		p[i] = color.Gray{uint8(i)}
+	}
+	return p
+}()
+
+func toPaletted(frame image.Image) *image.Paletted {
+	if gray, ok := frame.(*image.Gray); ok {
+		// The gray palette maps each level to its own index
+		paletted := image.NewPaletted(gray.Bounds(), grayPalette)
+		for y := gray.Rect.Min.Y; y < gray.Rect.Max.Y; y++ {
+			i := gray.PixOffset(gray.Rect.Min.X, y)
+			j := paletted.PixOffset(paletted.Rect.Min.X, y)
+			copy(paletted.Pix[j:j+gray.Rect.Dx()], gray.Pix[i:i+gray.Rect.Dx()])
+		}
+		return paletted
+	}
+
+	paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
+	draw.FloydSteinberg.Draw(paletted, paletted.Rect, frame, frame.Bounds().Min)
+	return paletted
+}
@@ -0,0 +1,164 @@
+package fade
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempFile(t *testing.T, name string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "fade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, name)
+}
+
+func grayFrame(w, h int, value func(x, y int) uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	forEachPixel(img.Rect, func(x, y int) {
+		img.SetGray(x, y, color.Gray{value(x, y)})
+	})
+	return img
+}
+
+func TestGifWriterRoundTrip(t *testing.T) {
+	filename := tempFile(t, "out.gif")
+
+	// Colors already in the Plan9 palette are not changed by dithering
+	colors := []color.Color{palette.Plan9[17], palette.Plan9[130], palette.Plan9[201]}
+	rgba := image.NewRGBA(image.Rect(0, 0, 5, 3))
+	forEachPixel(rgba.Rect, func(x, y int) {
+		rgba.Set(x, y, colors[(x+y)%len(colors)])
+	})
+
+	frames := []image.Image{
+		grayFrame(5, 3, func(x, y int) uint8 { return uint8(x*50 + y) }),
+		rgba,
+		grayFrame(5, 3, func(x, y int) uint8 { return uint8(255 - x*y) }),
+	}
+
+	w := NewGifWriter(filename, Timing{FPS: 10, LoopCount: 3})
+	for _, frame := range frames {
+		if err := w.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	decoded, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.Image) != len(frames) {
+		t.Fatalf("got %d frames, want %d", len(decoded.Image), len(frames))
+	}
+	if decoded.LoopCount != 3 {
+		t.Errorf("got loop count %d, want 3", decoded.LoopCount)
+	}
+	for i, frame := range frames {
+		if decoded.Delay[i] != 10 {
+			t.Errorf("frame %d: got delay %d, want 10", i, decoded.Delay[i])
+		}
+		got := decoded.Image[i]
+		forEachPixel(frame.Bounds(), func(x, y int) {
+			wr, wg, wb, _ := frame.At(x, y).RGBA()
+			gr, gg, gb, _ := got.At(x, y).RGBA()
+			if wr>>8 != gr>>8 || wg>>8 != gg>>8 || wb>>8 != gb>>8 {
+				t.Errorf("frame %d: pixel (%d, %d) is %v, want %v", i, x, y, got.At(x, y), frame.At(x, y))
+			}
+		})
+	}
+
+	// The color frame needs its own palette, the gray frames share the global one
+	for i, p := range []color.Palette{grayPalette, palette.Plan9, grayPalette} {
+		if !sameColors(decoded.Image[i].Palette, p) {
+			t.Errorf("frame %d has the wrong palette", i)
+		}
+	}
+}
+
+func TestGifWriterFrameSize(t *testing.T) {
+	filename := tempFile(t, "out.gif")
+
+	w := NewGifWriter(filename, Timing{})
+	if err := w.WriteFrame(grayFrame(4, 4, func(x, y int) uint8 { return 0 })); err != nil {
+		t.Fatal(err)
+	}
+	// Frames are encoded one behind, so the mismatch may show on Close
+	err := w.WriteFrame(grayFrame(3, 4, func(x, y int) uint8 { return 0 }))
+	if err == nil {
+		err = w.Close()
+	}
+
+	var fadeErr *Error
+	if !errors.As(err, &fadeErr) || fadeErr.Op != OpEncode || !errors.Is(err, errFrameSize) {
+		t.Fatalf("got %v, want an encode error for the frame size", err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("partial gif was not removed: %v", err)
+	}
+}
+
+func TestGifWriterTiming(t *testing.T) {
+	filename := tempFile(t, "out.gif")
+
+	frame := grayFrame(2, 2, func(x, y int) uint8 { return 9 })
+	timing := Timing{FPS: 30, HoldLast: time.Second, LoopCount: -1}
+	if err := MakeGif(filename, []image.Image{frame, frame, frame}, timing); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	decoded, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 33.3ms frames round to 3, 4 and 3 units so the total stays on time
+	want := []int{3, 4, 103}
+	for i, delay := range decoded.Delay {
+		if delay != want[i] {
+			t.Errorf("delays %v, want %v", decoded.Delay, want)
+			break
+		}
+	}
+	if decoded.LoopCount != -1 {
+		t.Errorf("got loop count %d, want -1 for playing once", decoded.LoopCount)
+	}
+}
+
+func sameColors(a, b color.Palette) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		ar, ag, ab, _ := a[i].RGBA()
+		br, bg, bb, _ := b[i].RGBA()
+		if ar>>8 != br>>8 || ag>>8 != bg>>8 || ab>>8 != bb>>8 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	fade "github.com/aarich/image-fade/cmd/image-fade"
+)
+
+const (
+	defaultConfigFile = "goConfig.json"
+)
+
+type config struct {
+	Input        string   `json:"input"`
+	Output       string   `json:"output"`
+	Keyframes    []string `json:"keyframes"`
+	Hold         string   `json:"hold"`
+	Parallel     int      `json:"parallel"`
+	Transitioner string   `json:"transitioner"`
+	Gif          string   `json:"gif"`
+	Avi          string   `json:"avi"`
+	Iterations   int      `json:"iterations"`
+	Scale        int      `json:"scale"`
+	FPS          int      `json:"fps"`
+	Color        bool     `json:"color"`
+	Fit          string   `json:"fit"`
+	Easing       string   `json:"easing"`
+	Duration     string   `json:"duration"`
+	HoldFirst    string   `json:"holdFirst"`
+	HoldLast     string   `json:"holdLast"`
+	Loop         int      `json:"loop"`
+	PingPong     bool     `json:"pingpong"`
+	Timeout      string   `json:"timeout"`
+	Workers      int      `json:"workers"`
+	Search       string   `json:"search"`
+	Weight       float64  `json:"weight"`
+	TieBreak     string   `json:"tiebreak"`
+	Beam         int      `json:"beam"`
+	Pyramid      bool     `json:"pyramid"`
+	Seed         int64    `json:"seed"`
+	Neighborhood string   `json:"neighborhood"`
+	Score        string   `json:"score"`
+	Step         int      `json:"step"`
+	Quiet        bool     `json:"quiet"`
+}
+
+func defaultConfig() config {
+	return config{
+		Transitioner: "iterative",
+		Iterations:   20,
+		Scale:        1,
+		FPS:          fade.DefaultFPS,
+	}
+}
+
+// parseConfig parses the command line flags on top of the config file. Only
+// flags which are given explicitly override the file. If keyframeArgs is set
+// any arguments after the flags replace the keyframes, otherwise they are an
+// error.
+func parseConfig(fs *flag.FlagSet, args []string, keyframeArgs bool) (config, error) {
+	c := defaultConfig()
+
+	configFile := fs.String("config", "", "JSON config file (default "+defaultConfigFile+" if present)")
+	fs.StringVar(&c.Input, "in", c.Input, "image to fade from")
+	fs.StringVar(&c.Output, "out", c.Output, "image to fade to")
+	fs.StringVar(&c.Transitioner, "t", c.Transitioner, "transitioner name, see list")
+	fs.StringVar(&c.Gif, "gif", c.Gif, "write the transition to this gif file")
+	fs.StringVar(&c.Avi, "avi", c.Avi, "write the transition to this avi file")
+	fs.IntVar(&c.Iterations, "iterations", c.Iterations, "number of iterations")
+	fs.IntVar(&c.Scale, "scale", c.Scale, "pixel granularity for transitioners which support it")
+	fs.IntVar(&c.FPS, "fps", c.FPS, "frames per second of the output")
+	fs.BoolVar(&c.Color, "color", c.Color, "transition in color instead of grayscale")
+	fs.StringVar(&c.Fit, "fit", c.Fit, "how to reconcile image sizes: resize, crop, pad or contain")
+	fs.StringVar(&c.Easing, "easing", c.Easing, "easing curve, such as ease-in-out or cubic-bezier(x1,y1,x2,y2)")
+	fs.StringVar(&c.Duration, "duration", c.Duration, "resample the output to last this long, such as 3s")
+	fs.StringVar(&c.HoldFirst, "hold-first", c.HoldFirst, "extra time to show the first frame")
+	fs.StringVar(&c.HoldLast, "hold-last", c.HoldLast, "extra time to show the last frame")
+	fs.IntVar(&c.Loop, "loop", c.Loop, "times to restart the animation, 0 forever and -1 for none")
+	fs.BoolVar(&c.PingPong, "pingpong", c.PingPong, "play the transition forwards then backwards")
+	fs.StringVar(&c.Hold, "hold", c.Hold, "extra time to show each keyframe of a slideshow, without -easing or -duration")
+	fs.IntVar(&c.Parallel, "parallel", c.Parallel, "slideshow transitions to run at once")
+	fs.StringVar(&c.Timeout, "timeout", c.Timeout, "give up after this long, such as 30s")
+	fs.IntVar(&c.Workers, "workers", c.Workers, "goroutines per frame (default GOMAXPROCS)")
+	fs.StringVar(&c.Search, "search", c.Search, "A* search strategy: standard, weighted or greedy")
+	fs.Float64Var(&c.Weight, "weight", c.Weight, "heuristic weight for weighted A* search")
+	fs.StringVar(&c.TieBreak, "tiebreak", c.TieBreak, "A* tie breaking: low-h, fifo or lifo")
+	fs.IntVar(&c.Beam, "beam", c.Beam, "A* open list limit, negative for none (default depends on the images)")
+	fs.BoolVar(&c.Pyramid, "pyramid", c.Pyramid, "solve A* coarse to fine, starting at -scale")
+	fs.Int64Var(&c.Seed, "seed", c.Seed, "seed for the randomized transitioners")
+	fs.StringVar(&c.Neighborhood, "neighborhood", c.Neighborhood, "rule neighborhood: 4, 8, radius-N or a kernel such as 010,101,010")
+	fs.StringVar(&c.Score, "score", c.Score, "rule scoring: closest, local, grow or erode")
+	fs.IntVar(&c.Step, "step", c.Step, "how far the rule fades a pixel each frame (default 1)")
+	fs.BoolVar(&c.Quiet, "quiet", c.Quiet, "hide progress and log messages")
+
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if fs.NArg() > 0 && !keyframeArgs {
+		return c, fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	// Remember the explicit flags, load the file over everything, then
+	// apply the flags again so they win
+	explicit := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	if err := loadConfigFile(*configFile, &c); err != nil {
+		return c, err
+	}
+
+	for name, value := range explicit {
+		if err := fs.Set(name, value); err != nil {
+			return c, err
+		}
+	}
+	if fs.NArg() > 0 {
+		c.Keyframes = fs.Args()
+	}
+
+	return c, nil
+}
+
+// loadConfigFile reads filename into c. With no filename the default file is
+// used if it exists.
+func loadConfigFile(filename string, c *config) error {
+	if filename == "" {
+		filename = defaultConfigFile
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			return nil
+		}
+	}
+
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(bytes, c); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return nil
+}
+
+// fadeConfig converts the settings into the fade package's Config
+func (c config) fadeConfig() (fade.Config, error) {
+	fit, ok := fade.ParseFitMode(c.Fit)
+	if !ok && c.Fit != "" {
+		return fade.Config{}, fmt.Errorf("unknown fit mode %q", c.Fit)
+	}
+
+	search, ok := fade.ParseSearchStrategy(c.Search)
+	if !ok && c.Search != "" {
+		return fade.Config{}, fmt.Errorf("unknown search strategy %q", c.Search)
+	}
+
+	tieBreak, ok := fade.ParseTieBreak(c.TieBreak)
+	if !ok && c.TieBreak != "" {
+		return fade.Config{}, fmt.Errorf("unknown tie break %q", c.TieBreak)
+	}
+
+	var neighborhood fade.Neighborhood
+	if c.Neighborhood != "" {
+		var err error
+		if neighborhood, err = fade.ParseNeighborhood(c.Neighborhood); err != nil {
+			return fade.Config{}, err
+		}
+	}
+
+	score, ok := fade.ParseScore(c.Score)
+	if !ok && c.Score != "" {
+		return fade.Config{}, fmt.Errorf("unknown score %q", c.Score)
+	}
+
+	fc := fade.Config{
+		NumIterations: c.Iterations,
+		Scale:         c.Scale,
+		Fit:           fit,
+		Workers:       c.Workers,
+		Seed:          c.Seed,
+		AStar: fade.AStarConfig{
+			Strategy:  search,
+			Weight:    c.Weight,
+			TieBreak:  tieBreak,
+			BeamWidth: c.Beam,
+			Pyramid:   c.Pyramid,
+		},
+		Rule: fade.RuleConfig{
+			Neighborhood: neighborhood,
+			Score:        score,
+			Step:         c.Step,
+		},
+	}
+
+	if !c.Quiet {
+		fc.Progress = fade.NewProgressBar(os.Stdout)
+		fc.Logger = fade.LoggerFunc(log.New(os.Stderr, "", log.Ltime).Printf)
+	}
+	return fc, nil
+}
+
+func (c config) transitioner() (fade.Transitioner, error) {
+	t, ok := fade.Lookup(c.Transitioner)
+	if !ok {
+		return nil, fmt.Errorf("unknown transitioner %q, see list", c.Transitioner)
+	}
+	return t, nil
+}
+
+func (c config) timeout() (time.Duration, error) {
+	return parseDuration(c.Timeout)
+}
+
+// timing converts the output settings into the fade package's Timing
+func (c config) timing() (fade.Timing, error) {
+	t := fade.Timing{FPS: float64(c.FPS), LoopCount: c.Loop}
+
+	if c.Easing != "" {
+		easing, err := fade.ParseEasing(c.Easing)
+		if err != nil {
+			return t, err
+		}
+		t.Easing = easing
+	}
+
+	var err error
+	for _, d := range []struct {
+		value string
+		dest  *time.Duration
+	}{
+		{c.Duration, &t.Duration},
+		{c.HoldFirst, &t.HoldFirst},
+		{c.HoldLast, &t.HoldLast},
+	} {
+		if *d.dest, err = parseDuration(d.value); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
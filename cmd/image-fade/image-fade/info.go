@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"os"
+)
+
+func runInfo(args []string) error {
+	c, err := parseConfig(flag.NewFlagSet("info", flag.ContinueOnError), args, true)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Configuration:\n %+v\n\n", c)
+
+	if t, err := c.transitioner(); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Printf("Transitioner:\n %s: %s\n\n", t.Name(), t.Description())
+	}
+
+	fmt.Println("Images:")
+	for _, filename := range append([]string{c.Input, c.Output}, c.Keyframes...) {
+		if filename != "" {
+			fmt.Printf(" %s\n", describeImage(filename))
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// describeImage reports the format and size of an image without decoding it
+func describeImage(filename string) string {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err.Error()
+	}
+	defer file.Close()
+
+	ic, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", filename, err)
+	}
+	return fmt.Sprintf("%s: %s %dx%d", filename, format, ic.Width, ic.Height)
+}
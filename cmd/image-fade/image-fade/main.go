@@ -0,0 +1,83 @@
+// Command image-fade renders transitions between images.
+//
+// Usage:
+//
+//	image-fade render [flags]                   render a transition to gif and/or avi
+//	image-fade slideshow [flags] [keyframes]    render transitions between several images
+//	image-fade list                             list the available transitioners
+//	image-fade info [flags] [keyframes]         show the resolved configuration and images
+//
+// Settings are read from an optional JSON config file (goConfig.json in the
+// current directory by default), and any flags given override it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	fade "github.com/aarich/image-fade/cmd/image-fade"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+func commands() []command {
+	return []command{
+		{"render", "render a transition to gif and/or avi", runRender},
+		{"slideshow", "render transitions between several images", runSlideshow},
+		{"list", "list the available transitioners", runList},
+		{"info", "show the resolved configuration and input images", runInfo},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	for _, c := range commands() {
+		if c.name == name {
+			if err := c.run(os.Args[2:]); err != nil {
+				if err != flag.ErrHelp {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	if name != "help" && name != "-h" && name != "-help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+	}
+	printUsage()
+	os.Exit(2)
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "\nUsage:\n\t%s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands() {
+		fmt.Fprintf(os.Stderr, "\t%-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n\n", os.Args[0])
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, t := range fade.List() {
+		fmt.Fprintf(tw, "%s\t%s\n", t.Name(), t.Description())
+	}
+	return tw.Flush()
+}
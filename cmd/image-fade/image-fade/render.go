@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"os/signal"
+
+	fade "github.com/aarich/image-fade/cmd/image-fade"
+)
+
+func runRender(args []string) error {
+	c, err := parseConfig(flag.NewFlagSet("render", flag.ContinueOnError), args, false)
+	if err != nil {
+		return err
+	}
+
+	if c.Input == "" || c.Output == "" {
+		return errors.New("both -in and -out images are required")
+	}
+	if c.Gif == "" && c.Avi == "" {
+		return errors.New("nothing to write, give -gif and/or -avi")
+	}
+	if c.FPS <= 0 {
+		return fmt.Errorf("fps must be positive, got %d", c.FPS)
+	}
+
+	t, err := c.transitioner()
+	if err != nil {
+		return err
+	}
+
+	fadeConfig, err := c.fadeConfig()
+	if err != nil {
+		return err
+	}
+
+	timing, err := c.timing()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel, err := newContext(c)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	return render(ctx, t, c, fadeConfig, timing)
+}
+
+// newContext is cancelled on interrupt or once the configured timeout passes
+func newContext(c config) (context.Context, context.CancelFunc, error) {
+	timeout, err := c.timeout()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(interrupt)
+	}()
+
+	return ctx, cancel, nil
+}
+
+// render streams the transition straight into the requested encoders
+func render(ctx context.Context, t fade.Transitioner, c config, fadeConfig fade.Config, timing fade.Timing) error {
+	var sinks []fade.FrameSink
+	var closers []func() error
+
+	if c.Gif != "" {
+		w := fade.NewGifWriter(c.Gif, timing)
+		sinks = append(sinks, w)
+		closers = append(closers, w.Close)
+	}
+
+	if c.Avi != "" {
+		w := fade.NewAviWriter(c.Avi, timing)
+		sinks = append(sinks, w)
+		closers = append(closers, w.Close)
+	}
+
+	var err error
+	if c.PingPong {
+		err = pingPong(ctx, t, c, fadeConfig, fade.MultiSink(sinks...))
+	} else {
+		err = stream(ctx, t, c, fadeConfig, fade.MultiSink(sinks...))
+	}
+	for _, close := range closers {
+		if closeErr := close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// pingPong has to collect the whole transition before it can be played back
+func pingPong(ctx context.Context, t fade.Transitioner, c config, fadeConfig fade.Config, sink fade.FrameSink) error {
+	var frames []image.Image
+	err := stream(ctx, t, c, fadeConfig, fade.FrameSinkFunc(func(frame image.Image) error {
+		frames = append(frames, frame)
+		return nil
+	}))
+
+	for _, frame := range fade.PingPong(frames) {
+		if writeErr := sink.WriteFrame(frame); writeErr != nil {
+			return writeErr
+		}
+	}
+	return err
+}
+
+func stream(ctx context.Context, t fade.Transitioner, c config, fadeConfig fade.Config, sink fade.FrameSink) error {
+	if c.Color {
+		inImage, err := fade.LoadRGBA(c.Input)
+		if err != nil {
+			return err
+		}
+		outImage, err := fade.LoadRGBA(c.Output)
+		if err != nil {
+			return err
+		}
+		return fade.StreamRGBA(ctx, t, inImage, outImage, fadeConfig, sink)
+	}
+
+	inImage, err := fade.LoadGrayscale(c.Input)
+	if err != nil {
+		return err
+	}
+	outImage, err := fade.LoadGrayscale(c.Output)
+	if err != nil {
+		return err
+	}
+	return t.Stream(ctx, inImage, outImage, fadeConfig, sink)
+}
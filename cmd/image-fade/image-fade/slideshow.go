@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+
+	fade "github.com/aarich/image-fade/cmd/image-fade"
+)
+
+func runSlideshow(args []string) error {
+	c, err := parseConfig(flag.NewFlagSet("slideshow", flag.ContinueOnError), args, true)
+	if err != nil {
+		return err
+	}
+
+	if len(c.Keyframes) < 2 {
+		return errors.New("a slideshow needs at least two keyframes")
+	}
+	if c.Gif == "" && c.Avi == "" {
+		return errors.New("nothing to write, give -gif and/or -avi")
+	}
+	if c.FPS <= 0 {
+		return fmt.Errorf("fps must be positive, got %d", c.FPS)
+	}
+
+	t, err := c.transitioner()
+	if err != nil {
+		return err
+	}
+
+	fadeConfig, err := c.fadeConfig()
+	if err != nil {
+		return err
+	}
+
+	timing, err := c.timing()
+	if err != nil {
+		return err
+	}
+
+	hold, err := parseDuration(c.Hold)
+	if err != nil {
+		return err
+	}
+	if hold > 0 && (c.Easing != "" || c.Duration != "") {
+		// Resampling would drop the holds, and ease the whole slideshow at once
+		return errors.New("-hold cannot be combined with -easing or -duration")
+	}
+
+	keyframes, err := loadKeyframes(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel, err := newContext(c)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	frames, keys, err := fade.Slideshow(ctx, t, keyframes, fadeConfig,
+		fade.SlideshowOptions{Color: c.Color, Parallel: c.Parallel})
+	if err != nil {
+		return err
+	}
+
+	if c.PingPong {
+		keys = pingPongKeys(keys, len(frames))
+		frames = fade.PingPong(frames)
+	}
+	if hold > 0 {
+		timing = timing.Hold(keys, hold)
+	}
+
+	if c.Gif != "" {
+		if err := fade.MakeGif(c.Gif, frames, timing); err != nil {
+			return err
+		}
+	}
+	if c.Avi != "" {
+		if err := fade.MakeAvi(c.Avi, frames, timing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadKeyframes(c config) ([]image.Image, error) {
+	keyframes := make([]image.Image, len(c.Keyframes))
+	for i, filename := range c.Keyframes {
+		var err error
+		if c.Color {
+			keyframes[i], err = fade.LoadRGBA(filename)
+		} else {
+			keyframes[i], err = fade.LoadGrayscale(filename)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keyframes, nil
+}
+
+// pingPongKeys finds the keyframes again once fade.PingPong has played the n
+// frames back, which visits every keyframe but the first and last twice
+func pingPongKeys(keys []int, n int) []int {
+	mirrored := keys
+	for i := len(keys) - 2; i > 0; i-- {
+		mirrored = append(mirrored, 2*(n-1)-keys[i])
+	}
+	return mirrored
+}
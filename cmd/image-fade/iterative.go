@@ -1,54 +1,73 @@
 package fade
 
 import (
-	"fmt"
+	"context"
 	"image"
 	"image/color"
-	"time"
+	"sync/atomic"
 )
 
+func init() {
+	Register(NewTransitioner("iterative",
+		"Fades or slides in neighboring pixels one step at a time", IterativeStream))
+}
+
 // Iterative generates an iterative transition, returning an array of images
 // representing the fade.
 // The iterative algorithm generates the next image in the transition pixel by
 // pixel by choosing either a fade (+/- 1) or a neighboring pixel (giving the
 // effect of elements of the image sliding around)
-func Iterative(in, out *image.Gray, config Config) []*image.Gray {
-	defer timeTrack(time.Now(), "iterative transitioner")
+func Iterative(ctx context.Context, in, out *image.Gray, config Config) ([]*image.Gray, error) {
+	return collect(ctx, IterativeStream, in, out, config)
+}
 
-	fmt.Println("Running iterative")
+// IterativeStream is the streaming form of Iterative. Only the frame being
+// worked on is kept, so memory use does not grow with NumIterations.
+func IterativeStream(ctx context.Context, in, out *image.Gray, config Config, sink FrameSink) error {
+	progress := config.progress()
+	progress.Start("iterative transitioner", config.NumIterations)
+	defer progress.Done()
 
-	var images []*image.Gray
+	in, out = Normalize(in, out, config.Fit)
 
-	images = append(images, in)
+	if err := sink.WriteFrame(in); err != nil {
+		return err
+	}
 	nextFrame := in
 
-	fmt.Println()
-
 	for i := 0; i < config.NumIterations; i++ {
-		nextFrame, _ = getNextImage(nextFrame, out)
-		images = append(images, nextFrame)
-		printStatus(i+1, config.NumIterations)
-	}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-	images = append(images, out)
+		nextFrame, _ = getNextImage(nextFrame, out, config.Workers)
+		if err := sink.WriteFrame(nextFrame); err != nil {
+			return err
+		}
+		progress.Update(i + 1)
+	}
 
-	fmt.Println("\r")
-	fmt.Println()
-	return images
+	return sink.WriteFrame(out)
 }
 
-func getNextImage(in, out *image.Gray) (*image.Gray, int) {
+// getNextImage steps every pixel once. Each pixel only depends on the
+// previous frame, so bands of rows are computed concurrently.
+func getNextImage(in, out *image.Gray, workers int) (*image.Gray, int) {
 	current := copyGray(in)
-	numChanged := 0
-	forEachPixel(in.Bounds(), func(x int, y int) {
-		nextValue, didChange := getNextPixel(x, y, in, out)
-		if didChange {
-			current.SetGray(x, y, color.Gray{uint8(nextValue)})
-			numChanged++
-		}
+	var numChanged int64
+	forEachBand(in.Bounds(), workers, func(band image.Rectangle) {
+		bandChanged := 0
+		forEachPixelIn(band, func(x int, y int) {
+			nextValue, didChange := getNextPixel(x, y, in, out)
+			if didChange {
+				current.SetGray(x, y, color.Gray{uint8(nextValue)})
+				bandChanged++
+			}
+		})
+		atomic.AddInt64(&numChanged, int64(bandChanged))
 	})
 
-	return current, numChanged
+	return current, int(numChanged)
 }
 
 func getNextPixel(x, y int, in, out *image.Gray) (int, bool) {
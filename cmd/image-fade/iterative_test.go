@@ -0,0 +1,31 @@
+package fade
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestIterativeWorkers(t *testing.T) {
+	// 23 rows do not split evenly between 7 workers
+	in := grayFrame(17, 23, func(x, y int) uint8 { return uint8(x * y * 7) })
+	out := grayFrame(17, 23, func(x, y int) uint8 { return uint8((x + 3*y) * 11) })
+
+	serial, err := Iterative(context.Background(), in, out, Config{NumIterations: 30, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := Iterative(context.Background(), in, out, Config{NumIterations: 30, Workers: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(serial) != len(parallel) {
+		t.Fatalf("got %d frames with 7 workers, want %d", len(parallel), len(serial))
+	}
+	for i := range serial {
+		if serial[i].Rect != parallel[i].Rect || !bytes.Equal(serial[i].Pix, parallel[i].Pix) {
+			t.Errorf("frame %d differs between 1 and 7 workers", i)
+		}
+	}
+}
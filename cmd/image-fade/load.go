@@ -0,0 +1,98 @@
+package fade
+
+import (
+	"image"
+	"image/draw"
+	"io"
+	"os"
+
+	// Register the decoders understood by image.Decode
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/harrydb/go/img/grayscale"
+)
+
+// LoadGrayscale is a utility function to load an image by filename then use
+// the grayscale package to convert to gray using ToGrayLuminance. The format
+// (jpeg, png or gif) is detected from the file contents.
+func LoadGrayscale(filename string) (*image.Gray, error) {
+	src, err := loadImage(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ToGrayscale(src), nil
+}
+
+// LoadRGBA is a utility function to load an image by filename, keeping its
+// color information
+func LoadRGBA(filename string) (*image.RGBA, error) {
+	src, err := loadImage(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ToRGBA(src), nil
+}
+
+// DecodeGrayscale reads an image in any registered format from r, such as an
+// http request body or an in-memory buffer, and converts it to gray
+func DecodeGrayscale(r io.Reader) (*image.Gray, error) {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, &Error{OpDecode, "", err}
+	}
+
+	return ToGrayscale(src), nil
+}
+
+// DecodeRGBA reads an image in any registered format from r, keeping its
+// color information
+func DecodeRGBA(r io.Reader) (*image.RGBA, error) {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, &Error{OpDecode, "", err}
+	}
+
+	return ToRGBA(src), nil
+}
+
+// ToGrayscale converts an already decoded image to gray using
+// ToGrayLuminance. Gray images are returned as is.
+func ToGrayscale(src image.Image) *image.Gray {
+	if gray, ok := src.(*image.Gray); ok {
+		return gray
+	}
+
+	return grayscale.Convert(src, grayscale.ToGrayLuminance)
+}
+
+// ToRGBA converts an already decoded image to RGBA. RGBA images are returned
+// as is.
+func ToRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok {
+		return rgba
+	}
+
+	rgba := image.NewRGBA(src.Bounds())
+	draw.Draw(rgba, rgba.Rect, src, src.Bounds().Min, draw.Src)
+	return rgba
+}
+
+func loadImage(filename string) (image.Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, &Error{OpOpen, filename, err}
+	}
+
+	defer file.Close()
+
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return nil, &Error{OpDecode, filename, err}
+	}
+
+	return src, nil
+}
@@ -0,0 +1,146 @@
+package fade
+
+import (
+	"image"
+	"math"
+)
+
+// FitMode controls how input and output images of different sizes are
+// reconciled before a transition runs
+type FitMode int
+
+const (
+	// FitResize stretches the output to the dimensions of the input
+	FitResize FitMode = iota
+	// FitCrop center-crops both images to the size they have in common
+	FitCrop
+	// FitPad letterboxes both images, centered, onto the smallest size that
+	// holds either of them
+	FitPad
+	// FitContain scales the output to fit inside the input keeping its aspect
+	// ratio, then letterboxes the rest
+	FitContain
+)
+
+var fitModeNames = map[FitMode]string{
+	FitResize:  "resize",
+	FitCrop:    "crop",
+	FitPad:     "pad",
+	FitContain: "contain",
+}
+
+func (m FitMode) String() string {
+	if name, ok := fitModeNames[m]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseFitMode returns the FitMode with the given name
+func ParseFitMode(name string) (FitMode, bool) {
+	for m, n := range fitModeNames {
+		if n == name {
+			return m, true
+		}
+	}
+	return FitResize, false
+}
+
+// Normalize returns versions of in and out with identical bounds anchored at
+// the origin, as the transitioners expect. Images which already agree are
+// returned untouched. Letterboxing fills with black.
+func Normalize(in, out *image.Gray, mode FitMode) (*image.Gray, *image.Gray) {
+	return normalize(in, out, mode, 0)
+}
+
+func normalize(in, out *image.Gray, mode FitMode, fill uint8) (*image.Gray, *image.Gray) {
+	inW, inH := in.Rect.Dx(), in.Rect.Dy()
+	outW, outH := out.Rect.Dx(), out.Rect.Dy()
+
+	if inW != outW || inH != outH {
+		switch mode {
+		case FitCrop:
+			w, h := minInt(inW, outW), minInt(inH, outH)
+			in, out = cropGray(in, w, h), cropGray(out, w, h)
+		case FitPad:
+			w, h := maxInt(inW, outW), maxInt(inH, outH)
+			in, out = padGray(in, w, h, fill), padGray(out, w, h, fill)
+		case FitContain:
+			f := math.Min(float64(inW)/float64(outW), float64(inH)/float64(outH))
+			w := maxInt(1, int(math.Round(float64(outW)*f)))
+			h := maxInt(1, int(math.Round(float64(outH)*f)))
+			out = padGray(resizeGray(out, w, h), inW, inH, fill)
+		default:
+			out = resizeGray(out, inW, inH)
+		}
+	}
+
+	return rebase(in), rebase(out)
+}
+
+// rebase moves an image's bounds to start at the origin
+func rebase(img *image.Gray) *image.Gray {
+	if img.Rect.Min == (image.Point{}) {
+		return img
+	}
+	return cropGray(img, img.Rect.Dx(), img.Rect.Dy())
+}
+
+// cropGray copies the centered w by h region of src
+func cropGray(src *image.Gray, w, h int) *image.Gray {
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	x0 := src.Rect.Min.X + (src.Rect.Dx()-w)/2
+	y0 := src.Rect.Min.Y + (src.Rect.Dy()-h)/2
+	for y := 0; y < h; y++ {
+		i := src.PixOffset(x0, y0+y)
+		copy(dst.Pix[y*dst.Stride:y*dst.Stride+w], src.Pix[i:i+w])
+	}
+	return dst
+}
+
+// padGray centers src on a w by h image filled with fill
+func padGray(src *image.Gray, w, h int, fill uint8) *image.Gray {
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range dst.Pix {
+		dst.Pix[i] = fill
+	}
+
+	x0 := (w - src.Rect.Dx()) / 2
+	y0 := (h - src.Rect.Dy()) / 2
+	for y := 0; y < src.Rect.Dy(); y++ {
+		i := src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y+y)
+		j := dst.PixOffset(x0, y0+y)
+		copy(dst.Pix[j:j+src.Rect.Dx()], src.Pix[i:i+src.Rect.Dx()])
+	}
+	return dst
+}
+
+// resizeGray scales src to w by h with bilinear interpolation
+func resizeGray(src *image.Gray, w, h int) *image.Gray {
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+
+	at := func(x, y int) float64 {
+		return float64(src.Pix[src.PixOffset(src.Rect.Min.X+x, src.Rect.Min.Y+y)])
+	}
+
+	for y := 0; y < h; y++ {
+		sy := clampFloat((float64(y)+0.5)*float64(sh)/float64(h)-0.5, 0, float64(sh-1))
+		y0 := int(sy)
+		y1 := minInt(y0+1, sh-1)
+		fy := sy - float64(y0)
+
+		for x := 0; x < w; x++ {
+			sx := clampFloat((float64(x)+0.5)*float64(sw)/float64(w)-0.5, 0, float64(sw-1))
+			x0 := int(sx)
+			x1 := minInt(x0+1, sw-1)
+			fx := sx - float64(x0)
+
+			top := at(x0, y0)*(1-fx) + at(x1, y0)*fx
+			bottom := at(x0, y1)*(1-fx) + at(x1, y1)*fx
+			dst.Pix[y*dst.Stride+x] = uint8(math.Round(top*(1-fy) + bottom*fy))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,174 @@
+package fade
+
+import (
+	"context"
+	"image"
+	"math"
+	"sort"
+)
+
+func init() {
+	Register(NewTransitioner("pixel-sort",
+		"Moves every pixel to the place of the output pixel with the same brightness rank",
+		PixelSortStream(PixelSortOptions{})))
+	Register(NewTransitioner("pixel-sort-local",
+		"Like pixel-sort, but pixels prefer to stay near where they start",
+		PixelSortStream(PixelSortOptions{Locality: 0.5})))
+}
+
+// PixelSortOptions controls how pixels are matched between the images
+type PixelSortOptions struct {
+	// Locality from 0 to 1 weighs position against brightness when ranking.
+	// At 0 pixels are ranked only by brightness, so the brightest pixel of in
+	// travels to the brightest of out wherever it is. Higher values rank more
+	// by position along a Z-order curve, keeping moves shorter at the cost of
+	// brightness changing more on the way.
+	Locality float64
+}
+
+// PixelSort treats in as a fixed set of pixels which rearrange themselves
+// into out. Pixels of both images are ranked, and each pixel of in travels in
+// a straight line to the place of the pixel of out with the same rank while
+// its brightness changes to match, over NumIterations frames.
+func PixelSort(ctx context.Context, in, out *image.Gray, config Config, opts PixelSortOptions) ([]*image.Gray, error) {
+	return collect(ctx, PixelSortStream(opts), in, out, config)
+}
+
+// PixelSortStream returns the streaming form of PixelSort for opts
+func PixelSortStream(opts PixelSortOptions) StreamFunc {
+	return func(ctx context.Context, in, out *image.Gray, config Config, sink FrameSink) error {
+		progress := config.progress()
+		progress.Start("pixel sort transitioner", config.NumIterations)
+		defer progress.Done()
+
+		in, out = Normalize(in, out, config.Fit)
+
+		if err := sink.WriteFrame(in); err != nil {
+			return err
+		}
+
+		locality := clampFloat(opts.Locality, 0, 1)
+		from, to := rankPixels(in, locality), rankPixels(out, locality)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		for i := 1; i <= config.NumIterations; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			t := float64(i) / float64(config.NumIterations+1)
+			if err := sink.WriteFrame(sortedFrame(in, out, from, to, t, config.Workers)); err != nil {
+				return err
+			}
+			progress.Update(i)
+		}
+
+		return sink.WriteFrame(out)
+	}
+}
+
+// rankPixels orders the pixels of img, relative to its origin, by brightness
+// blended with their Z-order position. Ties keep the Z-order, which keeps
+// pixels of the same brightness near each other.
+func rankPixels(img *image.Gray, locality float64) []image.Point {
+	bounds := img.Bounds()
+	pixels := make([]image.Point, 0, bounds.Dx()*bounds.Dy())
+	forEachPixel(bounds, func(x, y int) {
+		pixels = append(pixels, image.Pt(x, y))
+	})
+
+	mortons := make([]uint64, len(pixels))
+	var maxMorton uint64 = 1
+	for i, p := range pixels {
+		mortons[i] = morton(p.X, p.Y)
+		if mortons[i] > maxMorton {
+			maxMorton = mortons[i]
+		}
+	}
+
+	keys := make([]float64, len(pixels))
+	for i, p := range pixels {
+		value := float64(img.GrayAt(bounds.Min.X+p.X, bounds.Min.Y+p.Y).Y) / 255
+		keys[i] = (1-locality)*value + locality*float64(mortons[i])/float64(maxMorton)
+	}
+
+	order := make([]int, len(pixels))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		if keys[i] != keys[j] {
+			return keys[i] < keys[j]
+		}
+		return mortons[i] < mortons[j]
+	})
+
+	ranked := make([]image.Point, len(pixels))
+	for rank, i := range order {
+		ranked[rank] = pixels[i]
+	}
+	return ranked
+}
+
+// morton interleaves the bits of x and y into a position along a Z-order
+// curve, on which nearby pixels are mostly close together
+func morton(x, y int) uint64 {
+	var z uint64
+	for bit := uint(0); bit < 32; bit++ {
+		z |= uint64(x>>bit&1) << (2 * bit)
+		z |= uint64(y>>bit&1) << (2*bit + 1)
+	}
+	return z
+}
+
+// sortedFrame renders the pixels a fraction t of the way from their places in
+// from to their places in to. Each pixel is spread over the four nearest
+// places, and anywhere none land cross-fades.
+func sortedFrame(in, out *image.Gray, from, to []image.Point, t float64, workers int) *image.Gray {
+	bounds := in.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	sums := make([]float64, w*h)
+	weights := make([]float64, w*h)
+
+	splat := func(x, y int, value, weight float64) {
+		if x < 0 || y < 0 || x >= w || y >= h || weight == 0 {
+			return
+		}
+		sums[y*w+x] += value * weight
+		weights[y*w+x] += weight
+	}
+
+	for rank, start := range from {
+		end := to[rank]
+		startValue := float64(in.GrayAt(bounds.Min.X+start.X, bounds.Min.Y+start.Y).Y)
+		endValue := float64(out.GrayAt(bounds.Min.X+end.X, bounds.Min.Y+end.Y).Y)
+		value := (1-t)*startValue + t*endValue
+
+		x := (1-t)*float64(start.X) + t*float64(end.X)
+		y := (1-t)*float64(start.Y) + t*float64(end.Y)
+		x0, y0 := int(x), int(y)
+		tx, ty := x-float64(x0), y-float64(y0)
+		splat(x0, y0, value, (1-tx)*(1-ty))
+		splat(x0+1, y0, value, tx*(1-ty))
+		splat(x0, y0+1, value, (1-tx)*ty)
+		splat(x0+1, y0+1, value, tx*ty)
+	}
+
+	frame := image.NewGray(bounds)
+	forEachBand(bounds, workers, func(band image.Rectangle) {
+		forEachPixelIn(band, func(x, y int) {
+			i := (y-bounds.Min.Y)*w + x - bounds.Min.X
+			var value float64
+			if weights[i] > 0 {
+				value = sums[i] / weights[i]
+			} else {
+				value = (1-t)*float64(in.GrayAt(x, y).Y) + t*float64(out.GrayAt(x, y).Y)
+			}
+			frame.Pix[frame.PixOffset(x, y)] = uint8(math.Round(clampFloat(value, 0, 255)))
+		})
+	})
+	return frame
+}
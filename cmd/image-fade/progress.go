@@ -0,0 +1,117 @@
+package fade
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Progress receives updates as a transitioner works, so callers can route
+// them to a terminal, structured logs, metrics or a UI. Set it on Config; when
+// nil progress is discarded.
+type Progress interface {
+	// Start begins a task expected to take total steps, or 0 if unknown
+	Start(task string, total int)
+	// Update reports how many steps of the current task are done
+	Update(done int)
+	// Done marks the current task as finished
+	Done()
+}
+
+// Logger receives informational messages. Set it on Config; when nil
+// messages are discarded.
+type Logger interface {
+	Logf(format string, args ...interface{})
+}
+
+// LoggerFunc adapts a printf style function, such as log.Printf, to a Logger
+type LoggerFunc func(format string, args ...interface{})
+
+// Logf calls f(format, args...)
+func (f LoggerFunc) Logf(format string, args ...interface{}) {
+	f(format, args...)
+}
+
+type nopProgress struct{}
+
+func (nopProgress) Start(string, int) {}
+func (nopProgress) Update(int)        {}
+func (nopProgress) Done()             {}
+
+type nopLogger struct{}
+
+func (nopLogger) Logf(string, ...interface{}) {}
+
+func (c Config) progress() Progress {
+	if c.Progress == nil {
+		return nopProgress{}
+	}
+	return c.Progress
+}
+
+func (c Config) logger() Logger {
+	if c.Logger == nil {
+		return nopLogger{}
+	}
+	return c.Logger
+}
+
+// ProgressBar is a Progress which draws a text progress bar. Each update
+// begins with \r so it redraws over the previous one.
+type ProgressBar struct {
+	w     io.Writer
+	mu    sync.Mutex
+	task  string
+	total int
+	start time.Time
+}
+
+// NewProgressBar creates a ProgressBar drawing to w, typically os.Stdout
+func NewProgressBar(w io.Writer) *ProgressBar {
+	return &ProgressBar{w: w}
+}
+
+// Start prints the task name and remembers when it began
+func (p *ProgressBar) Start(task string, total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.task, p.total, p.start = task, total, time.Now()
+	fmt.Fprintf(p.w, "%s\n", task)
+}
+
+// Update redraws the bar. With an unknown total only the count is shown.
+func (p *ProgressBar) Update(done int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.total <= 0 {
+		fmt.Fprintf(p.w, "\r(%d)", done)
+		return
+	}
+
+	scaledTotal, scaledCur := p.total, done
+	if p.total > 100 {
+		scaledTotal = 100
+		scaledCur = int(float32(done) / float32(p.total) * 100.0)
+	}
+
+	bar := make([]byte, scaledTotal)
+	for i := range bar {
+		if i < scaledCur {
+			bar[i] = '#'
+		} else {
+			bar[i] = '='
+		}
+	}
+	fmt.Fprintf(p.w, "\r[%s] (%d/%d)", bar, done, p.total)
+}
+
+// Done ends the bar's line and prints how long the task took
+func (p *ProgressBar) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintf(p.w, "\r\n%s took %s\n", p.task, time.Since(p.start))
+}
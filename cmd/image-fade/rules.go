@@ -0,0 +1,249 @@
+package fade
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+func init() {
+	Register(NewTransitioner("rule",
+		"Like iterative, with the neighborhood, scoring and step of Config.Rule", RuleStream))
+}
+
+// RuleConfig is the rule a cellular automaton transition applies to every
+// pixel each frame: the pixel either fades Step closer to its goal or copies
+// the best scoring neighbor. The zero value fades by one and looks at the four
+// adjacent pixels, preferring whichever is closest to the goal.
+type RuleConfig struct {
+	// Neighborhood is which pixels may be copied. Nil is the four adjacent.
+	Neighborhood Neighborhood
+	// Score rates each candidate, lowest best. Nil is ScoreClosest.
+	Score ScoreFunc
+	// Step is how far a pixel fades when no neighbor is better. Zero or less
+	// is one.
+	Step int
+}
+
+// Neighborhood is the offsets of the pixels around a pixel which it may copy
+type Neighborhood []image.Point
+
+// VonNeumann is the pixels within radius steps along rows and columns
+func VonNeumann(radius int) Neighborhood {
+	return kernelWhere(radius, func(dx, dy int) bool { return abs(dx)+abs(dy) <= radius })
+}
+
+// Moore is the square of pixels within radius
+func Moore(radius int) Neighborhood {
+	return kernelWhere(radius, func(dx, dy int) bool { return true })
+}
+
+// Disk is the pixels within a straight line distance of radius
+func Disk(radius int) Neighborhood {
+	return kernelWhere(radius, func(dx, dy int) bool { return dx*dx+dy*dy <= radius*radius })
+}
+
+func kernelWhere(radius int, in func(dx, dy int) bool) Neighborhood {
+	var n Neighborhood
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			if (dx != 0 || dy != 0) && in(dx, dy) {
+				n = append(n, image.Pt(dx, dy))
+			}
+		}
+	}
+	return n
+}
+
+// ParseNeighborhood reads a neighborhood: 4 or 8 for the adjacent pixels,
+// radius-N for a disk, or a custom kernel given as comma separated rows of 0
+// and 1 around the pixel, such as 010,101,010. Kernels need an odd number of
+// rows and columns, and the center is ignored.
+func ParseNeighborhood(spec string) (Neighborhood, error) {
+	switch spec {
+	case "4":
+		return VonNeumann(1), nil
+	case "8":
+		return Moore(1), nil
+	}
+
+	var radius int
+	if strings.HasPrefix(spec, "radius-") {
+		if _, err := fmt.Sscanf(spec, "radius-%d", &radius); err == nil && radius > 0 {
+			return Disk(radius), nil
+		}
+		return nil, fmt.Errorf("bad neighborhood %q, the radius must be a positive whole number", spec)
+	}
+
+	rows := strings.Split(spec, ",")
+	if len(rows)%2 == 0 || len(rows[0])%2 == 0 {
+		return nil, fmt.Errorf("unknown neighborhood %q", spec)
+	}
+	var n Neighborhood
+	cx, cy := len(rows[0])/2, len(rows)/2
+	for y, row := range rows {
+		if len(row) != len(rows[0]) {
+			return nil, fmt.Errorf("bad neighborhood %q, the kernel rows differ in length", spec)
+		}
+		for x, c := range row {
+			switch {
+			case c == '1' && (x != cx || y != cy):
+				n = append(n, image.Pt(x-cx, y-cy))
+			case c != '0' && c != '1':
+				return nil, fmt.Errorf("unknown neighborhood %q", spec)
+			}
+		}
+	}
+	if len(n) == 0 {
+		return nil, fmt.Errorf("bad neighborhood %q, the kernel has no pixels besides the center", spec)
+	}
+	return n, nil
+}
+
+// ScoreFunc rates copying candidate into a pixel with the value current and
+// the goal desired, lower being better. offset is where the candidate is
+// relative to the pixel, zero for the faded value. A neighbor replaces the
+// fade if it scores no worse, so ties slide; an infinite score rules a
+// neighbor out.
+type ScoreFunc func(current, candidate, desired int, offset image.Point) float64
+
+// Built in scores
+var (
+	// ScoreClosest prefers the candidate closest to the goal
+	ScoreClosest ScoreFunc = func(current, candidate, desired int, offset image.Point) float64 {
+		return float64(abs(desired - candidate))
+	}
+	// ScoreLocal is ScoreClosest plus the distance to the candidate, so far
+	// neighbors need to be that much closer to the goal to be copied
+	ScoreLocal ScoreFunc = func(current, candidate, desired int, offset image.Point) float64 {
+		return float64(abs(desired-candidate)) + math.Hypot(float64(offset.X), float64(offset.Y))
+	}
+	// ScoreGrow only copies brighter neighbors, so bright areas spread
+	ScoreGrow ScoreFunc = func(current, candidate, desired int, offset image.Point) float64 {
+		if offset != (image.Point{}) && candidate < current {
+			return math.Inf(1)
+		}
+		return float64(abs(desired - candidate))
+	}
+	// ScoreErode only copies darker neighbors, so dark areas spread
+	ScoreErode ScoreFunc = func(current, candidate, desired int, offset image.Point) float64 {
+		if offset != (image.Point{}) && candidate > current {
+			return math.Inf(1)
+		}
+		return float64(abs(desired - candidate))
+	}
+)
+
+var scoreNames = map[string]ScoreFunc{
+	"closest": ScoreClosest,
+	"local":   ScoreLocal,
+	"grow":    ScoreGrow,
+	"erode":   ScoreErode,
+}
+
+// ParseScore returns the built in score with the given name
+func ParseScore(name string) (ScoreFunc, bool) {
+	score, ok := scoreNames[name]
+	return score, ok
+}
+
+func (r RuleConfig) neighborhood() Neighborhood {
+	if r.Neighborhood == nil {
+		return VonNeumann(1)
+	}
+	return r.Neighborhood
+}
+
+func (r RuleConfig) score() ScoreFunc {
+	if r.Score == nil {
+		return ScoreClosest
+	}
+	return r.Score
+}
+
+// Rule runs a cellular automaton transition with config.Rule. Each frame every
+// pixel looks only at the previous frame, so with the default rule this is
+// the iterative transition with pixels always fading towards their goal.
+func Rule(ctx context.Context, in, out *image.Gray, config Config) ([]*image.Gray, error) {
+	return collect(ctx, RuleStream, in, out, config)
+}
+
+// RuleStream is the streaming form of Rule
+func RuleStream(ctx context.Context, in, out *image.Gray, config Config, sink FrameSink) error {
+	progress := config.progress()
+	progress.Start("rule transitioner", config.NumIterations)
+	defer progress.Done()
+
+	in, out = Normalize(in, out, config.Fit)
+
+	if err := sink.WriteFrame(in); err != nil {
+		return err
+	}
+	nextFrame := in
+
+	rule := ruleStep{config.Rule.neighborhood(), config.Rule.score(), maxInt(config.Rule.Step, 1)}
+	for i := 0; i < config.NumIterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		nextFrame = rule.nextImage(nextFrame, out, config.Workers)
+		if err := sink.WriteFrame(nextFrame); err != nil {
+			return err
+		}
+		progress.Update(i + 1)
+	}
+
+	return sink.WriteFrame(out)
+}
+
+// ruleStep is a RuleConfig with its defaults filled in
+type ruleStep struct {
+	neighborhood Neighborhood
+	score        ScoreFunc
+	step         int
+}
+
+func (r ruleStep) nextImage(in, out *image.Gray, workers int) *image.Gray {
+	next := copyGray(in)
+	forEachBand(in.Bounds(), workers, func(band image.Rectangle) {
+		forEachPixelIn(band, func(x, y int) {
+			if value, changed := r.nextPixel(x, y, in, out); changed {
+				next.SetGray(x, y, color.Gray{uint8(value)})
+			}
+		})
+	})
+	return next
+}
+
+func (r ruleStep) nextPixel(x, y int, in, out *image.Gray) (int, bool) {
+	current := int(in.GrayAt(x, y).Y)
+	desired := int(out.GrayAt(x, y).Y)
+
+	if current == desired {
+		return current, false
+	}
+
+	next := current + minInt(r.step, abs(desired-current))
+	if desired < current {
+		next = current - minInt(r.step, current-desired)
+	}
+	best := r.score(current, next, desired, image.Point{})
+
+	bounds := in.Bounds()
+	for _, offset := range r.neighborhood {
+		p := image.Pt(x, y).Add(offset)
+		if !p.In(bounds) {
+			continue
+		}
+		option := int(in.GrayAt(p.X, p.Y).Y)
+		if score := r.score(current, option, desired, offset); !math.IsInf(score, 1) && score <= best {
+			next, best = option, score
+		}
+	}
+
+	return next, true
+}
@@ -0,0 +1,27 @@
+package fade
+
+import "testing"
+
+func TestParseNeighborhood(t *testing.T) {
+	for spec, want := range map[string]int{
+		"4":                             4,
+		"8":                             8,
+		"radius-2":                      12,
+		"010,101,010":                   4,
+		"111,111,111":                   8,
+		"00100,00000,10001,00000,00100": 4,
+	} {
+		n, err := ParseNeighborhood(spec)
+		if err != nil {
+			t.Errorf("%s: %v", spec, err)
+		} else if len(n) != want {
+			t.Errorf("%s: got %d pixels, want %d", spec, len(n), want)
+		}
+	}
+
+	for _, spec := range []string{"", "1", "0", "000,010,000", "000,000,000", "01,10", "010,11,010", "0x0,101,010", "radius-0"} {
+		if n, err := ParseNeighborhood(spec); err == nil {
+			t.Errorf("%q: got %v, want an error", spec, n)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package fade
+
+import "image"
+
+// Reverse returns the frames in the opposite order, for playing a transition
+// from its output back to its input
+func Reverse(frames []image.Image) []image.Image {
+	reversed := make([]image.Image, len(frames))
+	for i, frame := range frames {
+		reversed[len(frames)-1-i] = frame
+	}
+	return reversed
+}
+
+// PingPong plays the frames forwards and then backwards, A to B to A. The
+// last frame is not repeated at the turn, and the first is left off the end
+// so the sequence loops seamlessly.
+func PingPong(frames []image.Image) []image.Image {
+	if len(frames) < 3 {
+		return Concat(frames)
+	}
+	return Concat(frames, Reverse(frames[1:len(frames)-1]))
+}
+
+// Concat joins sequences end to end into a new slice
+func Concat(sequences ...[]image.Image) []image.Image {
+	n := 0
+	for _, s := range sequences {
+		n += len(s)
+	}
+
+	joined := make([]image.Image, 0, n)
+	for _, s := range sequences {
+		joined = append(joined, s...)
+	}
+	return joined
+}
@@ -0,0 +1,74 @@
+package fade
+
+import (
+	"context"
+	"image"
+)
+
+// FrameSink receives frames one at a time as a transitioner produces them,
+// so a transition can be encoded without holding every frame in memory. A
+// sink may keep the frames it is given; transitioners never modify a frame
+// after writing it. Returning an error stops the transition.
+type FrameSink interface {
+	WriteFrame(frame image.Image) error
+}
+
+// FrameSinkFunc adapts a plain function to a FrameSink
+type FrameSinkFunc func(frame image.Image) error
+
+// WriteFrame calls f(frame)
+func (f FrameSinkFunc) WriteFrame(frame image.Image) error {
+	return f(frame)
+}
+
+// ChanSink returns a sink which sends every frame on ch. Once ctx is done it
+// stops waiting for the receiver and returns ctx.Err(), which stops the
+// transition.
+func ChanSink(ctx context.Context, ch chan<- image.Image) FrameSink {
+	return FrameSinkFunc(func(frame image.Image) error {
+		select {
+		case ch <- frame:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// MultiSink duplicates every frame to each of the given sinks, for example to
+// encode a gif and an avi in the same pass
+func MultiSink(sinks ...FrameSink) FrameSink {
+	return FrameSinkFunc(func(frame image.Image) error {
+		for _, s := range sinks {
+			if err := s.WriteFrame(frame); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type grayCollector struct {
+	frames []*image.Gray
+}
+
+func (c *grayCollector) WriteFrame(frame image.Image) error {
+	c.frames = append(c.frames, ToGrayscale(frame))
+	return nil
+}
+
+type rgbaCollector struct {
+	frames []*image.RGBA
+}
+
+func (c *rgbaCollector) WriteFrame(frame image.Image) error {
+	c.frames = append(c.frames, ToRGBA(frame))
+	return nil
+}
+
+// collect runs a streaming transition and gathers its frames
+func collect(ctx context.Context, fn StreamFunc, in, out *image.Gray, config Config) ([]*image.Gray, error) {
+	c := &grayCollector{}
+	err := fn(ctx, in, out, config, c)
+	return c.frames, err
+}
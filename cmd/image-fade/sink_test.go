@@ -0,0 +1,30 @@
+package fade
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+	"time"
+)
+
+func TestChanSinkCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan image.Image)
+
+	done := make(chan error)
+	go func() {
+		// Nothing reads from ch, so only the cancellation can end this
+		done <- ChanSink(ctx, ch).WriteFrame(image.NewGray(image.Rect(0, 0, 1, 1)))
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WriteFrame is still blocked after cancelling")
+	}
+}
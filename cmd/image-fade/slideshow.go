@@ -0,0 +1,162 @@
+package fade
+
+import (
+	"context"
+	"errors"
+	"image"
+	"sync"
+)
+
+// ErrTooFewKeyframes is returned by Slideshow when there is nothing to
+// transition between
+var ErrTooFewKeyframes = errors.New("fade: a slideshow needs at least two keyframes")
+
+// SlideshowOptions controls how a slideshow is made
+type SlideshowOptions struct {
+	// Transition each color channel rather than in grayscale
+	Color bool
+
+	// How many transitions may run at once. Zero or one runs them one after
+	// another.
+	Parallel int
+}
+
+// Slideshow runs t between each consecutive pair of keyframes and joins the
+// transitions into one sequence, without repeating the keyframe where two
+// meet. Keyframes are first brought to a common size with config.Fit: the
+// size of the first keyframe, or for crop and pad the smallest or largest
+// size of any of them.
+//
+// Along with the frames it returns the index of each keyframe among them,
+// which Timing.Hold can use to pause on the keyframes. If ctx is cancelled
+// the frames of the transitions before the first unfinished one are returned
+// with ctx.Err().
+func Slideshow(ctx context.Context, t Transitioner, keyframes []image.Image, config Config, opts SlideshowOptions) ([]image.Image, []int, error) {
+	if len(keyframes) < 2 {
+		return nil, nil, ErrTooFewKeyframes
+	}
+
+	pairs := len(keyframes) - 1
+	progress := config.progress()
+	progress.Start("slideshow", pairs)
+	defer progress.Done()
+
+	runPair := slideshowPairs(t, keyframes, config, opts.Color)
+
+	// Transitions report as a whole rather than each one
+	pairConfig := config
+	pairConfig.Progress = nil
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parallel := maxInt(opts.Parallel, 1)
+	segments := make([][]image.Image, pairs)
+	errs := make([]error, pairs)
+	slots := make(chan struct{}, parallel)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error // the cause, rather than a cancellation it led to
+	done := 0
+
+	for i := 0; i < pairs; i++ {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			segments[i], errs[i] = runPair(ctx, i, pairConfig)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if errs[i] != nil {
+				if firstErr == nil {
+					firstErr = errs[i]
+				}
+				cancel()
+				return
+			}
+			done++
+			progress.Update(done)
+		}(i)
+	}
+	wg.Wait()
+
+	var frames []image.Image
+	var keys []int
+	for i, segment := range segments {
+		if errs[i] != nil {
+			return frames, keys, firstErr
+		}
+		if i > 0 && len(segment) > 0 {
+			// The first frame is the previous transition's last
+			segment = segment[1:]
+		} else {
+			keys = append(keys, 0)
+		}
+		frames = append(frames, segment...)
+		keys = append(keys, len(frames)-1)
+	}
+	return frames, keys, nil
+}
+
+// slideshowPairs converts the keyframes to a common size, returning a function
+// which runs the transition from keyframe i to i+1
+func slideshowPairs(t Transitioner, keyframes []image.Image, config Config, color bool) func(ctx context.Context, i int, config Config) ([]image.Image, error) {
+	size := keyframeSize(keyframes, config.Fit)
+
+	if color {
+		rgba := make([]*image.RGBA, len(keyframes))
+		for i, k := range keyframes {
+			channels := splitChannels(ToRGBA(k))
+			for c := range channels {
+				// Letterboxing should stay opaque
+				var fill uint8
+				if c == 3 {
+					fill = 255
+				}
+				channels[c] = fitKeyframe(channels[c], size, config.Fit, fill)
+			}
+			rgba[i] = mergeChannels(channels)
+		}
+
+		return func(ctx context.Context, i int, config Config) ([]image.Image, error) {
+			frames, err := RunRGBA(ctx, t, rgba[i], rgba[i+1], config)
+			return FramesRGBA(frames), err
+		}
+	}
+
+	gray := make([]*image.Gray, len(keyframes))
+	for i, k := range keyframes {
+		gray[i] = fitKeyframe(ToGrayscale(k), size, config.Fit, 0)
+	}
+
+	return func(ctx context.Context, i int, config Config) ([]image.Image, error) {
+		frames, err := Run(ctx, t, gray[i], gray[i+1], config)
+		return Frames(frames), err
+	}
+}
+
+// keyframeSize is the size every keyframe is fit to
+func keyframeSize(keyframes []image.Image, mode FitMode) image.Point {
+	size := keyframes[0].Bounds().Size()
+	for _, k := range keyframes[1:] {
+		s := k.Bounds().Size()
+		switch mode {
+		case FitCrop:
+			size = image.Pt(minInt(size.X, s.X), minInt(size.Y, s.Y))
+		case FitPad:
+			size = image.Pt(maxInt(size.X, s.X), maxInt(size.Y, s.Y))
+		}
+	}
+	return size
+}
+
+// fitKeyframe fits img to size by normalizing it against a blank image of
+// that size, which crop and pad leave alone since size is already the
+// smallest or largest
+func fitKeyframe(img *image.Gray, size image.Point, mode FitMode, fill uint8) *image.Gray {
+	_, fitted := normalize(image.NewGray(image.Rectangle{Max: size}), img, mode, fill)
+	return fitted
+}
@@ -0,0 +1,186 @@
+package fade
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+func init() {
+	Register(NewTransitioner("random-order",
+		"Like iterative, but pixels update in place in a random order",
+		StochasticStream(StochasticOptions{RandomOrder: true})))
+	Register(NewTransitioner("random-neighbor",
+		"Like iterative, but each pixel picks a random improving neighbor",
+		StochasticStream(StochasticOptions{RandomNeighbor: true})))
+	Register(NewTransitioner("dither",
+		"Fades each pixel in randomly rounded steps to arrive on the last iteration",
+		StochasticStream(StochasticOptions{Dither: true})))
+	Register(NewTransitioner("stochastic",
+		"Combines random order, random neighbors and dithered steps",
+		StochasticStream(StochasticOptions{true, true, true})))
+}
+
+// StochasticOptions chooses the randomness a stochastic transition uses. All
+// of it is drawn from Config.Seed, so the same seed renders the same frames.
+type StochasticOptions struct {
+	// RandomOrder updates the pixels of each frame one at a time in a random
+	// order, so a pixel may copy a neighbor which already moved this frame
+	RandomOrder bool
+	// RandomNeighbor picks at random between the fade step and the neighbors
+	// closer to the goal, rather than the closest
+	RandomNeighbor bool
+	// Dither sizes the fade step so each pixel arrives on the last iteration,
+	// rounding up or down at random
+	Dither bool
+}
+
+// Stochastic runs a randomized variant of the iterative transition
+func Stochastic(ctx context.Context, in, out *image.Gray, config Config, opts StochasticOptions) ([]*image.Gray, error) {
+	return collect(ctx, StochasticStream(opts), in, out, config)
+}
+
+// StochasticStream returns the streaming form of Stochastic for opts
+func StochasticStream(opts StochasticOptions) StreamFunc {
+	return func(ctx context.Context, in, out *image.Gray, config Config, sink FrameSink) error {
+		progress := config.progress()
+		progress.Start("stochastic transitioner", config.NumIterations)
+		defer progress.Done()
+
+		in, out = Normalize(in, out, config.Fit)
+
+		if err := sink.WriteFrame(in); err != nil {
+			return err
+		}
+		nextFrame := in
+
+		for i := 0; i < config.NumIterations; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			step := stochasticStep{opts, config.Seed, i, config.NumIterations - i}
+			nextFrame = step.nextImage(nextFrame, out, config.Workers)
+			if err := sink.WriteFrame(nextFrame); err != nil {
+				return err
+			}
+			progress.Update(i + 1)
+		}
+
+		return sink.WriteFrame(out)
+	}
+}
+
+// stochasticStep makes one frame of a stochastic transition
+type stochasticStep struct {
+	opts      StochasticOptions
+	seed      int64
+	frame     int
+	remaining int // iterations left including this one
+}
+
+// nextImage steps every pixel once. In random order the pixels depend on each
+// other and are visited serially, otherwise bands of rows run concurrently.
+// Every row draws from its own generator so the result does not depend on
+// the number of workers.
+func (s stochasticStep) nextImage(in, out *image.Gray, workers int) *image.Gray {
+	current := copyGray(in)
+	bounds := in.Bounds()
+
+	if s.opts.RandomOrder {
+		r := s.rand(-1)
+		w := bounds.Dx()
+		for _, i := range r.Perm(w * bounds.Dy()) {
+			x, y := bounds.Min.X+i%w, bounds.Min.Y+i/w
+			if next, changed := s.nextPixel(x, y, current, out, r); changed {
+				current.SetGray(x, y, color.Gray{uint8(next)})
+			}
+		}
+		return current
+	}
+
+	forEachBand(bounds, workers, func(band image.Rectangle) {
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			r := s.rand(y)
+			for x := band.Min.X; x < band.Max.X; x++ {
+				if next, changed := s.nextPixel(x, y, in, out, r); changed {
+					current.SetGray(x, y, color.Gray{uint8(next)})
+				}
+			}
+		}
+	})
+	return current
+}
+
+// rand makes the generator for a row of this frame, or for the whole frame
+// with row -1
+func (s stochasticStep) rand(row int) *rand.Rand {
+	z := splitmix64(uint64(s.seed))
+	z = splitmix64(z ^ uint64(s.frame))
+	z = splitmix64(z ^ uint64(row))
+	return rand.New(rand.NewSource(int64(z)))
+}
+
+// nextPixel chooses the next value of a pixel from a fade step towards the
+// goal and the neighbors which are closer to it than the pixel is now
+func (s stochasticStep) nextPixel(x, y int, in, out *image.Gray, r *rand.Rand) (int, bool) {
+	current := int(in.GrayAt(x, y).Y)
+	desired := int(out.GrayAt(x, y).Y)
+
+	if current == desired {
+		return current, false
+	}
+
+	var candidates [5]int
+	n := 0
+
+	if step := s.fadeStep(abs(desired-current), r); step > 0 {
+		if desired < current {
+			step = -step
+		}
+		candidates[n] = current + step
+		n++
+	}
+
+	bounds := in.Bounds()
+	for _, p := range []image.Point{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+		if p.In(bounds) {
+			option := int(in.GrayAt(p.X, p.Y).Y)
+			if abs(desired-option) < abs(desired-current) {
+				candidates[n] = option
+				n++
+			}
+		}
+	}
+
+	if n == 0 {
+		return current, false
+	}
+	if s.opts.RandomNeighbor {
+		return candidates[r.Intn(n)], true
+	}
+
+	best := candidates[0]
+	for _, c := range candidates[1:n] {
+		if abs(desired-c) < abs(desired-best) {
+			best = c
+		}
+	}
+	return best, true
+}
+
+// fadeStep is how far a pixel dist away from its goal fades this frame
+func (s stochasticStep) fadeStep(dist int, r *rand.Rand) int {
+	if !s.opts.Dither {
+		return 1
+	}
+
+	step := float64(dist) / float64(s.remaining)
+	whole, frac := math.Modf(step)
+	if r.Float64() < frac {
+		whole++
+	}
+	return minInt(int(whole), dist)
+}
@@ -0,0 +1,274 @@
+package fade
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+	"time"
+)
+
+// DefaultFPS is the frame rate used when Timing.FPS is not set
+const DefaultFPS = 20
+
+// Timing controls how long each frame of an animation is shown. The zero value
+// shows every frame once at DefaultFPS.
+type Timing struct {
+	// Base frame rate. Zero or less uses DefaultFPS.
+	FPS float64
+
+	// Display time of individual frames, indexed like the frames written.
+	// Frames without a positive entry last 1/FPS. Ignored when frames are
+	// resampled.
+	Delays []time.Duration
+
+	// Remaps the progress through the transition, so it can speed up or slow
+	// down. Nil is linear. Setting it resamples the frames.
+	Easing Easing
+
+	// Resamples the frames to play for this long at FPS, not counting holds.
+	// Zero keeps the number of frames.
+	Duration time.Duration
+
+	// How much longer to show the first and last frames
+	HoldFirst time.Duration
+	HoldLast  time.Duration
+
+	// How many times the animation restarts, as in image/gif: 0 loops
+	// forever, -1 plays once and otherwise it plays LoopCount+1 times. An avi
+	// cannot loop, so it repeats the frames instead, playing once if forever.
+	LoopCount int
+}
+
+// plays is how many times an animation which cannot loop should be repeated
+func (t Timing) plays() int {
+	if t.LoopCount > 0 {
+		return t.LoopCount + 1
+	}
+	return 1
+}
+
+// A Step is one frame of a schedule: which of the frames to show and for how
+// long
+type Step struct {
+	Frame int
+	Delay time.Duration
+}
+
+func (t Timing) fps() float64 {
+	if t.FPS <= 0 {
+		return DefaultFPS
+	}
+	return t.FPS
+}
+
+func (t Timing) frameDelay() time.Duration {
+	return time.Duration(float64(time.Second) / t.fps())
+}
+
+// resamples reports whether the schedule depends on how many frames there are
+// in total, so frames cannot be shown until all of them are known
+func (t Timing) resamples() bool {
+	return t.Easing != nil || t.Duration > 0
+}
+
+// delay is how long frame i lasts before holds when frames are not resampled
+func (t Timing) delay(i int) time.Duration {
+	if i < len(t.Delays) && t.Delays[i] > 0 {
+		return t.Delays[i]
+	}
+	return t.frameDelay()
+}
+
+// Schedule lays out an animation of n frames. Consecutive steps always show
+// different frames; a frame the easing lingers on becomes one longer step.
+func (t Timing) Schedule(n int) []Step {
+	if n <= 0 {
+		return nil
+	}
+
+	var steps []Step
+	if !t.resamples() {
+		steps = make([]Step, n)
+		for i := range steps {
+			steps[i] = Step{i, t.delay(i)}
+		}
+	} else {
+		count := n
+		if t.Duration > 0 {
+			count = maxInt(int(math.Round(t.Duration.Seconds()*t.fps())), 1)
+		}
+
+		easing := t.Easing
+		if easing == nil {
+			easing = Linear
+		}
+
+		for i := 0; i < count; i++ {
+			progress := 1.0
+			if count > 1 {
+				progress = float64(i) / float64(count-1)
+			}
+			frame := int(math.Round(clampFloat(easing(progress), 0, 1) * float64(n-1)))
+
+			if len(steps) > 0 && steps[len(steps)-1].Frame == frame {
+				steps[len(steps)-1].Delay += t.frameDelay()
+			} else {
+				steps = append(steps, Step{frame, t.frameDelay()})
+			}
+		}
+	}
+
+	steps[0].Delay += t.HoldFirst
+	steps[len(steps)-1].Delay += t.HoldLast
+	return steps
+}
+
+// Hold returns a copy of t which shows each of the given frames for hold
+// longer, by setting Delays. Delays are ignored when t resamples the frames,
+// so the holds are lost if Easing or Duration is set.
+func (t Timing) Hold(frames []int, hold time.Duration) Timing {
+	n := len(t.Delays)
+	for _, f := range frames {
+		n = maxInt(n, f+1)
+	}
+
+	delays := make([]time.Duration, n)
+	for i := range delays {
+		delays[i] = t.delay(i)
+	}
+	for _, f := range frames {
+		delays[f] += hold
+	}
+
+	t.Delays = delays
+	return t
+}
+
+// An Easing maps progress through an animation, from 0 to 1, to progress
+// through the transition
+type Easing func(t float64) float64
+
+// Built in easing curves
+var (
+	Linear         Easing = func(t float64) float64 { return t }
+	EaseIn         Easing = func(t float64) float64 { return t * t }
+	EaseOut        Easing = func(t float64) float64 { return t * (2 - t) }
+	EaseInOut      Easing = CubicBezier(0.42, 0, 0.58, 1)
+	EaseInCubic    Easing = func(t float64) float64 { return t * t * t }
+	EaseOutCubic   Easing = func(t float64) float64 { return 1 - math.Pow(1-t, 3) }
+	EaseInOutCubic Easing = func(t float64) float64 {
+		if t < 0.5 {
+			return 4 * t * t * t
+		}
+		return 1 - math.Pow(-2*t+2, 3)/2
+	}
+)
+
+var easingNames = map[string]Easing{
+	"linear":       Linear,
+	"ease-in":      EaseIn,
+	"ease-out":     EaseOut,
+	"ease-in-out":  EaseInOut,
+	"cubic-in":     EaseInCubic,
+	"cubic-out":    EaseOutCubic,
+	"cubic-in-out": EaseInOutCubic,
+}
+
+// ParseEasing returns the easing with the given name, or a custom curve
+// written as cubic-bezier(x1,y1,x2,y2) like in CSS
+func ParseEasing(name string) (Easing, error) {
+	if easing, ok := easingNames[name]; ok {
+		return easing, nil
+	}
+
+	var x1, y1, x2, y2 float64
+	if strings.HasPrefix(name, "cubic-bezier(") {
+		if _, err := fmt.Sscanf(name, "cubic-bezier(%g,%g,%g,%g)", &x1, &y1, &x2, &y2); err == nil {
+			return CubicBezier(x1, y1, x2, y2), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown easing %q", name)
+}
+
+// CubicBezier makes an easing from a cubic bezier curve through (0, 0) and
+// (1, 1) with the control points (x1, y1) and (x2, y2), as in CSS. x1 and x2
+// are clamped to [0, 1] so the curve is a function of time.
+func CubicBezier(x1, y1, x2, y2 float64) Easing {
+	x1, x2 = clampFloat(x1, 0, 1), clampFloat(x2, 0, 1)
+
+	bezier := func(t, p1, p2 float64) float64 {
+		u := 1 - t
+		return 3*u*u*t*p1 + 3*u*t*t*p2 + t*t*t
+	}
+
+	return func(x float64) float64 {
+		// x(t) is monotonic, so bisect for the t giving x
+		lo, hi := 0.0, 1.0
+		for i := 0; i < 50; i++ {
+			mid := (lo + hi) / 2
+			if bezier(mid, x1, x2) < x {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		return bezier((lo+hi)/2, y1, y2)
+	}
+}
+
+// frameScheduler applies a Timing to frames written one at a time, passing
+// each with its delay to encode. Without resampling the last frame is held
+// back until the next arrives, since it may need HoldLast; with resampling
+// every frame is held until flush.
+type frameScheduler struct {
+	timing   Timing
+	encode   func(frame image.Image, delay time.Duration) error
+	pending  image.Image
+	count    int
+	buffered []image.Image
+}
+
+func (s *frameScheduler) add(frame image.Image) error {
+	if s.timing.resamples() {
+		s.buffered = append(s.buffered, frame)
+		return nil
+	}
+
+	if s.pending != nil {
+		delay := s.timing.delay(s.count - 1)
+		if s.count == 1 {
+			delay += s.timing.HoldFirst
+		}
+		if err := s.encode(s.pending, delay); err != nil {
+			return err
+		}
+	}
+	s.pending = frame
+	s.count++
+	return nil
+}
+
+// flush encodes whatever is held back. Nothing may be added afterwards.
+func (s *frameScheduler) flush() error {
+	if s.timing.resamples() {
+		for _, step := range s.timing.Schedule(len(s.buffered)) {
+			if err := s.encode(s.buffered[step.Frame], step.Delay); err != nil {
+				return err
+			}
+		}
+		s.buffered = nil
+		return nil
+	}
+
+	if s.pending == nil {
+		return nil
+	}
+	delay := s.timing.delay(s.count-1) + s.timing.HoldLast
+	if s.count == 1 {
+		delay += s.timing.HoldFirst
+	}
+	frame := s.pending
+	s.pending = nil
+	return s.encode(frame, delay)
+}
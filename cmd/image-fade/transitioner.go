@@ -0,0 +1,104 @@
+package fade
+
+import (
+	"context"
+	"image"
+	"sort"
+	"sync"
+)
+
+// Transitioner is an algorithm for fading one grayscale image into another.
+// Implementations can be registered so they may be looked up by name.
+type Transitioner interface {
+	// Name is a short unique identifier, such as "iterative"
+	Name() string
+	// Description is a human readable summary of the algorithm
+	Description() string
+	// Stream generates the sequence of images from in to out, handing each
+	// to the sink as soon as it is ready. It should stop promptly once ctx is
+	// done, returning ctx.Err() after the frames written so far.
+	Stream(ctx context.Context, in, out *image.Gray, config Config, sink FrameSink) error
+}
+
+// StreamFunc is the signature shared by the built in streaming transitioners
+type StreamFunc func(ctx context.Context, in, out *image.Gray, config Config, sink FrameSink) error
+
+// NewTransitioner creates a Transitioner from a plain streaming function
+func NewTransitioner(name, description string, fn StreamFunc) Transitioner {
+	return funcTransitioner{name, description, fn}
+}
+
+// Run generates the whole sequence of images from in to out in memory. If ctx
+// is cancelled the frames made so far are returned along with ctx.Err().
+func Run(ctx context.Context, t Transitioner, in, out *image.Gray, config Config) ([]*image.Gray, error) {
+	return collect(ctx, t.Stream, in, out, config)
+}
+
+type funcTransitioner struct {
+	name        string
+	description string
+	fn          StreamFunc
+}
+
+func (t funcTransitioner) Name() string {
+	return t.name
+}
+
+func (t funcTransitioner) Description() string {
+	return t.description
+}
+
+func (t funcTransitioner) Stream(ctx context.Context, in, out *image.Gray, config Config, sink FrameSink) error {
+	return t.fn(ctx, in, out, config, sink)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Transitioner{}
+)
+
+// Register makes a transitioner available through Lookup and List. It is
+// intended to be called from init and panics if the transitioner is nil, has
+// no name, or its name is already taken.
+func Register(t Transitioner) {
+	if t == nil {
+		panic("fade: Register transitioner is nil")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	name := t.Name()
+	if name == "" {
+		panic("fade: Register transitioner has no name")
+	}
+	if _, dup := registry[name]; dup {
+		panic("fade: Register called twice for transitioner " + name)
+	}
+	registry[name] = t
+}
+
+// Lookup returns the registered transitioner with the given name
+func Lookup(name string) (Transitioner, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	t, ok := registry[name]
+	return t, ok
+}
+
+// List returns all registered transitioners sorted by name
+func List() []Transitioner {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	list := make([]Transitioner, 0, len(registry))
+	for _, t := range registry {
+		list = append(list, t)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
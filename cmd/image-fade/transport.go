@@ -0,0 +1,285 @@
+package fade
+
+import (
+	"context"
+	"image"
+	"math"
+)
+
+const (
+	transportGridSize   = 32   // cells along the longer side of the transport grid
+	transportSharpness  = 200  // the largest cost over the entropic regularization
+	transportIterations = 300  // most Sinkhorn iterations to run
+	transportTolerance  = 1e-6 // stop once the marginals are this close
+	transportMinMass    = 1e-9 // smaller plan entries are dropped
+)
+
+func init() {
+	Register(NewTransitioner("transport",
+		"Flows brightness like sand along an optimal transport plan", TransportStream))
+}
+
+// Transport treats both images as distributions of brightness and moves it
+// from in to out along an approximate optimal transport plan, found with
+// Sinkhorn iterations on a grid of at most 32 cells on a side. The cells move
+// in straight lines, carrying their share of brightness, while the detail
+// finer than a cell cross-fades. Scale above one makes the cells at least that
+// many pixels wide.
+func Transport(ctx context.Context, in, out *image.Gray, config Config) ([]*image.Gray, error) {
+	return collect(ctx, TransportStream, in, out, config)
+}
+
+// TransportStream is the streaming form of Transport
+func TransportStream(ctx context.Context, in, out *image.Gray, config Config, sink FrameSink) error {
+	progress := config.progress()
+	progress.Start("optimal transport transitioner", config.NumIterations)
+	defer progress.Done()
+
+	in, out = Normalize(in, out, config.Fit)
+
+	if err := sink.WriteFrame(in); err != nil {
+		return err
+	}
+
+	plan, err := newTransportPlan(ctx, in, out, config)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= config.NumIterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		t := float64(i) / float64(config.NumIterations+1)
+		if err := sink.WriteFrame(plan.frame(t, config.Workers)); err != nil {
+			return err
+		}
+		progress.Update(i)
+	}
+
+	return sink.WriteFrame(out)
+}
+
+// transportGrid is the coarse grid brightness is moved on
+type transportGrid struct {
+	bounds image.Rectangle // of the full resolution images
+	cell   int             // pixels per side of a cell
+	w, h   int             // size in cells
+}
+
+func newTransportGrid(bounds image.Rectangle, scale int) transportGrid {
+	longest := maxInt(bounds.Dx(), bounds.Dy())
+	cell := maxInt(maxInt(scale, 1), (longest+transportGridSize-1)/transportGridSize)
+	return transportGrid{
+		bounds,
+		cell,
+		(bounds.Dx() + cell - 1) / cell,
+		(bounds.Dy() + cell - 1) / cell,
+	}
+}
+
+func (g transportGrid) len() int {
+	return g.w * g.h
+}
+
+// average is the mean brightness of each cell of img
+func (g transportGrid) average(img *image.Gray) []float64 {
+	values := make([]float64, g.len())
+	counts := make([]int, g.len())
+	forEachPixelIn(g.bounds, func(x, y int) {
+		i := ((y-g.bounds.Min.Y)/g.cell)*g.w + (x-g.bounds.Min.X)/g.cell
+		values[i] += float64(img.GrayAt(x, y).Y)
+		counts[i]++
+	})
+	for i := range values {
+		values[i] /= float64(counts[i])
+	}
+	return values
+}
+
+// sample interpolates cell values at a pixel, relative to the image origin
+func (g transportGrid) sample(values []float64, x, y int) float64 {
+	fx := clampFloat((float64(x)+0.5)/float64(g.cell)-0.5, 0, float64(g.w-1))
+	fy := clampFloat((float64(y)+0.5)/float64(g.cell)-0.5, 0, float64(g.h-1))
+	x0, y0 := int(fx), int(fy)
+	x1, y1 := minInt(x0+1, g.w-1), minInt(y0+1, g.h-1)
+	tx, ty := fx-float64(x0), fy-float64(y0)
+
+	top := values[y0*g.w+x0]*(1-tx) + values[y0*g.w+x1]*tx
+	bottom := values[y1*g.w+x0]*(1-tx) + values[y1*g.w+x1]*tx
+	return top*(1-ty) + bottom*ty
+}
+
+// A transportMove carries mass from one cell to another
+type transportMove struct {
+	from, to int
+	mass     float64
+}
+
+// transportPlan is everything needed to render a frame at any time
+type transportPlan struct {
+	grid                transportGrid
+	moves               []transportMove
+	inTotal, outTotal   float64   // total brightness of the cells
+	inDetail, outDetail []float64 // what the cells leave out, per pixel
+}
+
+func newTransportPlan(ctx context.Context, in, out *image.Gray, config Config) (transportPlan, error) {
+	grid := newTransportGrid(in.Bounds(), config.Scale)
+	inCells, outCells := grid.average(in), grid.average(out)
+
+	p := transportPlan{grid: grid}
+	var a, b []float64
+	a, p.inTotal = distribution(inCells)
+	b, p.outTotal = distribution(outCells)
+
+	var err error
+	if p.moves, err = sinkhorn(ctx, grid, a, b, config.Workers); err != nil {
+		return p, err
+	}
+
+	p.inDetail = detail(in, grid, inCells)
+	p.outDetail = detail(out, grid, outCells)
+	return p, nil
+}
+
+// distribution scales values to sum to one, returning the original sum. An
+// all black image is spread evenly so there is still something to move.
+func distribution(values []float64) ([]float64, float64) {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+
+	d := make([]float64, len(values))
+	for i, v := range values {
+		if total > 0 {
+			d[i] = v / total
+		} else {
+			d[i] = 1 / float64(len(values))
+		}
+	}
+	return d, total
+}
+
+// detail is the difference between img and its cells interpolated back up
+func detail(img *image.Gray, grid transportGrid, cells []float64) []float64 {
+	d := make([]float64, grid.bounds.Dx()*grid.bounds.Dy())
+	forEachPixel(grid.bounds, func(x, y int) {
+		value := float64(img.GrayAt(grid.bounds.Min.X+x, grid.bounds.Min.Y+y).Y)
+		d[y*grid.bounds.Dx()+x] = value - grid.sample(cells, x, y)
+	})
+	return d
+}
+
+// sinkhorn finds an entropy regularized transport plan from a to b, costing
+// the squared distance between cells, and returns its significant entries
+func sinkhorn(ctx context.Context, grid transportGrid, a, b []float64, workers int) ([]transportMove, error) {
+	n := grid.len()
+
+	// The grid is the same at both ends, so the kernel is symmetric
+	maxCost := float64((grid.w-1)*(grid.w-1) + (grid.h-1)*(grid.h-1))
+	epsilon := math.Max(maxCost, 1) / transportSharpness
+	kernel := make([]float64, n*n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			dx, dy := i%grid.w-j%grid.w, i/grid.w-j/grid.w
+			kernel[i*n+j] = math.Exp(-float64(dx*dx+dy*dy) / epsilon)
+		}
+	}
+
+	u, v := make([]float64, n), make([]float64, n)
+	for i := range v {
+		v[i] = 1
+	}
+	kv := make([]float64, n)
+
+	// multiply sets dst to the kernel times src
+	multiply := func(dst, src []float64) {
+		forEachBand(image.Rect(0, 0, 1, n), workers, func(band image.Rectangle) {
+			for i := band.Min.Y; i < band.Max.Y; i++ {
+				sum := 0.0
+				row := kernel[i*n : (i+1)*n]
+				for j, k := range row {
+					sum += k * src[j]
+				}
+				dst[i] = sum
+			}
+		})
+	}
+
+	// scale sets dst to target over the kernel times src, returning how far
+	// the current marginal is from target
+	scale := func(dst, src, target []float64) float64 {
+		multiply(kv, src)
+		diff := 0.0
+		for i := range dst {
+			diff += math.Abs(dst[i]*kv[i] - target[i])
+			if kv[i] > 0 {
+				dst[i] = target[i] / kv[i]
+			} else {
+				dst[i] = 0
+			}
+		}
+		return diff
+	}
+
+	for iteration := 0; iteration < transportIterations; iteration++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		scale(u, v, a)
+		if scale(v, u, b) < transportTolerance && iteration > 0 {
+			break
+		}
+	}
+
+	var moves []transportMove
+	for i := 0; i < n; i++ {
+		if u[i] == 0 {
+			continue
+		}
+		for j := 0; j < n; j++ {
+			if mass := u[i] * kernel[i*n+j] * v[j]; mass > transportMinMass {
+				moves = append(moves, transportMove{i, j, mass})
+			}
+		}
+	}
+	return moves, nil
+}
+
+// frame renders the transition a fraction t of the way along. Every move's
+// mass is placed part way between its cells, split between the four nearest,
+// and the total brightness changes linearly.
+func (p transportPlan) frame(t float64, workers int) *image.Gray {
+	g := p.grid
+	cells := make([]float64, g.len())
+	total := (1-t)*p.inTotal + t*p.outTotal
+
+	for _, m := range p.moves {
+		x := (1-t)*float64(m.from%g.w) + t*float64(m.to%g.w)
+		y := (1-t)*float64(m.from/g.w) + t*float64(m.to/g.w)
+		x0, y0 := int(x), int(y)
+		x1, y1 := minInt(x0+1, g.w-1), minInt(y0+1, g.h-1)
+		tx, ty := x-float64(x0), y-float64(y0)
+
+		mass := m.mass * total
+		cells[y0*g.w+x0] += mass * (1 - tx) * (1 - ty)
+		cells[y0*g.w+x1] += mass * tx * (1 - ty)
+		cells[y1*g.w+x0] += mass * (1 - tx) * ty
+		cells[y1*g.w+x1] += mass * tx * ty
+	}
+
+	frame := image.NewGray(g.bounds)
+	w := g.bounds.Dx()
+	forEachBand(g.bounds, workers, func(band image.Rectangle) {
+		forEachPixelIn(band, func(x, y int) {
+			rx, ry := x-g.bounds.Min.X, y-g.bounds.Min.Y
+			i := ry*w + rx
+			value := g.sample(cells, rx, ry) + (1-t)*p.inDetail[i] + t*p.outDetail[i]
+			frame.Pix[frame.PixOffset(x, y)] = uint8(math.Round(clampFloat(value, 0, 255)))
+		})
+	})
+	return frame
+}
@@ -1,18 +1,11 @@
 package fade
 
 import (
-	"bytes"
-	"fmt"
 	"image"
-	"image/color/palette"
 	"image/draw"
-	"image/gif"
-	"image/jpeg"
-	"os"
-	"time"
-
-	"github.com/harrydb/go/img/grayscale"
-	"github.com/icza/mjpeg"
+	"math"
+	"runtime"
+	"sync"
 )
 
 // Config holds generic configuration info for the iterators
@@ -21,122 +14,34 @@ type Config struct {
 	// to not fully fade. For A* this will affect frequency of log output
 	NumIterations int
 	Scale         int // Some algorithms use this to speed up. Smaller numbers indicate finer granularity
-}
 
-// LoadGrayscale is a utility function to load an image by filename then use
-// the grayscale package to convert to gray using ToGrayLuminance
-func LoadGrayscale(filename string) *image.Gray {
-	file, err := os.Open(filename)
-	if err != nil {
-		panic(err.Error())
-	}
+	// How to reconcile input and output images of different sizes
+	Fit FitMode
 
-	defer file.Close()
+	// How many goroutines may share the work of a frame. Zero uses GOMAXPROCS.
+	Workers int
 
-	src, err := jpeg.Decode(file)
-	if err != nil {
-		panic(err.Error())
-	}
-
-	gray := grayscale.Convert(src, grayscale.ToGrayLuminance)
-
-	return gray
-}
+	// Seeds the randomized transitioners. The same seed gives the same frames.
+	Seed int64
 
-func MakeAvi(filename string, images []*image.Gray, fps int32) {
-	defer timeTrack(time.Now(), "making avi")
-	fmt.Println("Making AVI")
+	// Search settings for the A* transitioners
+	AStar AStarConfig
 
-	bounds := images[0].Bounds()
-	w := int32(bounds.Dx())
-	h := int32(bounds.Dy())
-	aw, err := mjpeg.New(filename, w, h, fps)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	defer aw.Close()
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-
-	for i, frame := range images {
-		buf := new(bytes.Buffer)
-		err = jpeg.Encode(buf, frame, nil)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+	// The rule the rule transitioner applies to every pixel
+	Rule RuleConfig
 
-		err = aw.AddFrame(buf.Bytes())
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		printStatus(i+1, len(images))
-	}
-
-	fmt.Println("\r")
+	// Where to report progress and log messages. Both default to discarding.
+	Progress Progress
+	Logger   Logger
 }
 
-// MakeGif is a utility method to convert a sequence of images and save it as
-// a gif.
-func MakeGif(filename string, images []*image.Gray) {
-	defer timeTrack(time.Now(), "making gif")
-	fmt.Println("Making GIF")
-
-	outGif := &gif.GIF{}
-
-	fmt.Println()
-	for i, frame := range images {
-		paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
-		draw.Draw(paletted, paletted.Rect, frame, frame.Bounds().Min, draw.Over)
-		outGif.Image = append(outGif.Image, paletted)
-		outGif.Delay = append(outGif.Delay, 5)
-
-		printStatus(i+1, len(images))
-	}
-
-	fmt.Println("\r")
-	// save to out.gif
-	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0600)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	defer f.Close()
-
-	err = gif.EncodeAll(f, outGif)
-	if err != nil {
-		fmt.Println(err)
+// Frames converts a grayscale transition into generic frames for encoding
+func Frames(images []*image.Gray) []image.Image {
+	frames := make([]image.Image, len(images))
+	for i, img := range images {
+		frames[i] = img
 	}
-}
-
-// PrintStatus print the status of a job as a progress bar.
-// It begins with \r so will clear any content previously written.
-// This is a simple utility function exported for ease of use
-func printStatus(cur, total int) {
-	fmt.Printf("\r[")
-
-	scaledTotal, scaledCur := total, cur
-	if total > 100 {
-		scaledTotal = 100
-		scaledCur = int(float32(cur) / float32(total) * 100.0)
-	}
-	for i := 0; i < scaledTotal; i++ {
-		if i < scaledCur {
-			fmt.Printf("#")
-		} else {
-			fmt.Printf("=")
-		}
-	}
-	fmt.Printf("] (%d/%d)", cur, total)
-}
-
-func timeTrack(start time.Time, name string) {
-	fmt.Printf("%s took %s\n", name, time.Since(start))
+	return frames
 }
 
 type pixelIterator func(int, int)
@@ -150,16 +55,44 @@ func forEachPixel(bounds image.Rectangle, fn pixelIterator) {
 	}
 }
 
-func forEachPixelScaled(bounds image.Rectangle, fn pixelIterator, scale int) {
-	for x := 0; x < bounds.Dx(); x++ {
-		for y := 0; y < bounds.Dy(); y++ {
-			if x%scale == 0 && y%scale == 0 {
-				fn(x, y)
-			}
+// forEachPixelIn visits the pixels of a rectangle in absolute coordinates
+func forEachPixelIn(rect image.Rectangle, fn pixelIterator) {
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			fn(x, y)
 		}
 	}
 }
 
+// forEachBand splits bounds into horizontal bands of rows and calls fn for
+// each on its own goroutine, returning once all are done
+func forEachBand(bounds image.Rectangle, workers int, fn func(band image.Rectangle)) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > bounds.Dy() {
+		workers = bounds.Dy()
+	}
+	if workers <= 1 {
+		fn(bounds)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		band := bounds
+		band.Min.Y = bounds.Min.Y + i*bounds.Dy()/workers
+		band.Max.Y = bounds.Min.Y + (i+1)*bounds.Dy()/workers
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(band)
+		}()
+	}
+	wg.Wait()
+}
+
 func iterate(bounds image.Rectangle, fn pixelAccumulator, scale, acc int) (result int) {
 	result = acc
 	for x := 0; x < bounds.Dx(); x++ {
@@ -185,12 +118,20 @@ func abs(x int) int {
 	return x
 }
 
-func reverseSlice(arr []*image.Gray) {
-	for i, j := 0, len(arr)-1; i < j; i, j = i+1, j-1 {
-		arr[i], arr[j] = arr[j], arr[i]
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
 	}
+	return b
 }
 
-func log(message string, a ...interface{}) {
-	fmt.Printf(message+"\n", a...)
+func clampFloat(x, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, x))
 }